@@ -0,0 +1,251 @@
+package cache
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+type (
+	//AdminConfig Struct for Configure the admin API
+	AdminConfig struct {
+		//Store defines which type of cache you use, same as CacheMiddlewareConfig (Default: gocache).
+		Store Store
+
+		//KeyPrefix cache key prefix used for stored responses, same as CacheMiddlewareConfig (Default: cache.DefaultCachePrefix).
+		KeyPrefix string
+
+		//Stats counters reported by the API, same as CacheMiddlewareConfig (Default: nil).
+		Stats *Stats
+
+		//ListLimit max number of keys returned when listing keys (Default: 1000).
+		ListLimit int
+	}
+
+	//AdminEntry cached response returned by the admin API
+	AdminEntry struct {
+		Key     string      `json:"key"`
+		URI     string      `json:"uri"`
+		Status  int         `json:"status"`
+		Header  http.Header `json:"header"`
+		Size    int         `json:"size"`
+		Created time.Time   `json:"created"`
+		Age     int64       `json:"age"`
+		TTL     *int64      `json:"ttl"`
+		Tags    []string    `json:"tags"`
+		Stale   bool        `json:"stale"`
+	}
+
+	adminHandler struct {
+		config AdminConfig
+	}
+)
+
+var (
+	//DefaultAdminConfig used by default if you don't specifies Config or value inside Config
+	DefaultAdminConfig = AdminConfig{
+		Store:     defaultStore,
+		KeyPrefix: DefaultCachePrefix,
+		ListLimit: 1000,
+	}
+)
+
+//RegisterAdmin mount the cache admin API on g
+// Protect g with your own middleware (authentication, ip filtering, ...), the API doesn't check anything
+// Don't mount it behind CacheMiddleware, admin responses would be cached too
+func RegisterAdmin(g *echo.Group) {
+	RegisterAdminWithConfig(g, DefaultAdminConfig)
+}
+
+//RegisterAdminWithConfig mount the cache admin API on g
+// Protect g with your own middleware (authentication, ip filtering, ...), the API doesn't check anything
+// Don't mount it behind CacheMiddleware, admin responses would be cached too
+//
+//  GET    /keys?prefix=&limit=     list keys starting with prefix, except tag indexes and locks (Store must implement ScanStore)
+//  DELETE /keys?prefix=            purge keys starting with prefix (Store must implement ScanStore)
+//  GET    /entries?key=            show a cached response, with its ttl if Store implements TTLStore
+//  DELETE /entries?key=&soft=      purge a cached response, or mark it stale if soft is true (see SoftPurge)
+//  GET    /tags/:tag               list keys of the responses cached with tag
+//  DELETE /tags/:tag?soft=         purge responses cached with tag, or mark them stale if soft is true
+//  POST   /flush                   flush the NamespaceStore, or purge every response cached under KeyPrefix
+//  GET    /stats                   hit / miss counters
+//  DELETE /stats                   reset hit / miss counters
+func RegisterAdminWithConfig(g *echo.Group, config AdminConfig) {
+	// Defaults
+	if config.Store == nil {
+		config.Store = DefaultAdminConfig.Store
+	}
+	if config.KeyPrefix == "" {
+		config.KeyPrefix = DefaultAdminConfig.KeyPrefix
+	}
+	if config.ListLimit <= 0 {
+		config.ListLimit = DefaultAdminConfig.ListLimit
+	}
+
+	h := &adminHandler{config}
+	g.GET("/keys", h.listKeys)
+	g.DELETE("/keys", h.purgeKeys)
+	g.GET("/entries", h.showEntry)
+	g.DELETE("/entries", h.purgeEntry)
+	g.GET("/tags/:tag", h.listTag)
+	g.DELETE("/tags/:tag", h.purgeTag)
+	g.POST("/flush", h.flush)
+	g.GET("/stats", h.showStats)
+	g.DELETE("/stats", h.resetStats)
+}
+
+func (h *adminHandler) listKeys(c echo.Context) error {
+	limit := h.config.ListLimit
+	if l, err := strconv.Atoi(c.QueryParam("limit")); err == nil && l > 0 {
+		limit = l
+	}
+
+	keys := []string{}
+	truncated := false
+	err := Scan(h.config.Store, c.QueryParam("prefix"), func(key string) bool {
+		if h.internal(key) {
+			return true
+		}
+		if len(keys) == limit {
+			truncated = true
+			return false
+		}
+		keys = append(keys, key)
+		return true
+	})
+	if err != nil {
+		return adminError(err)
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{"keys": keys, "truncated": truncated})
+}
+
+func (h *adminHandler) purgeKeys(c echo.Context) error {
+	prefix := c.QueryParam("prefix")
+	if prefix == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "missing prefix")
+	}
+
+	purged, err := PurgePrefix(h.config.Store, prefix)
+	if err != nil {
+		return adminError(err)
+	}
+	return c.JSON(http.StatusOK, echo.Map{"purged": purged})
+}
+
+func (h *adminHandler) showEntry(c echo.Context) error {
+	key := c.QueryParam("key")
+	if h.internal(key) {
+		return echo.NewHTTPError(http.StatusNotFound, "not a cached response")
+	}
+
+	var cache ResponseCache
+	if err := GetResponseMeta(c.Request().Context(), h.config.Store, key, &cache); err != nil {
+		if _, ok := err.(*typeError); ok {
+			return echo.NewHTTPError(http.StatusBadRequest, "not a cached response")
+		}
+		return adminError(err)
+	}
+
+	var ttl *int64
+	if remaining, err := TTL(h.config.Store, key); err == nil {
+		seconds := int64(remaining / time.Second)
+		if remaining == NEVER {
+			seconds = -1
+		}
+		ttl = &seconds
+	} else if err != ErrNotSupport {
+		return adminError(err)
+	}
+
+	return c.JSON(http.StatusOK, AdminEntry{
+		Key:     key,
+		URI:     cache.URI,
+		Status:  cache.Status,
+		Header:  cache.Header,
+		Size:    cache.Size,
+		Created: cache.Created,
+		Age:     int64(time.Since(cache.Created) / time.Second),
+		TTL:     ttl,
+		Tags:    cache.Tags,
+		Stale:   cache.Stale,
+	})
+}
+
+func (h *adminHandler) purgeEntry(c echo.Context) error {
+	key := c.QueryParam("key")
+
+	var err error
+	if soft, _ := strconv.ParseBool(c.QueryParam("soft")); soft {
+		err = SoftPurge(h.config.Store, key)
+	} else {
+		err = h.config.Store.Delete(key)
+	}
+	if err != nil {
+		return adminError(err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (h *adminHandler) listTag(c echo.Context) error {
+	keys, err := TaggedKeys(h.config.Store, h.config.KeyPrefix, c.Param("tag"))
+	if err != nil {
+		return adminError(err)
+	}
+	return c.JSON(http.StatusOK, echo.Map{"keys": keys})
+}
+
+func (h *adminHandler) purgeTag(c echo.Context) error {
+	purge := PurgeTag
+	if soft, _ := strconv.ParseBool(c.QueryParam("soft")); soft {
+		purge = SoftPurgeTag
+	}
+
+	purged, err := purge(h.config.Store, h.config.KeyPrefix, c.Param("tag"))
+	if err != nil {
+		return adminError(err)
+	}
+	return c.JSON(http.StatusOK, echo.Map{"purged": purged})
+}
+
+func (h *adminHandler) flush(c echo.Context) error {
+	if namespace, ok := h.config.Store.(*NamespaceStore); ok {
+		if err := namespace.Flush(); err != nil {
+			return adminError(err)
+		}
+		return c.JSON(http.StatusOK, echo.Map{"namespace": namespace.Namespace()})
+	}
+
+	purged, err := PurgePrefix(h.config.Store, h.config.KeyPrefix+":")
+	if err != nil {
+		return adminError(err)
+	}
+	return c.JSON(http.StatusOK, echo.Map{"purged": purged})
+}
+
+// internal returns true for the keys the middleware stores next to the responses, tag indexes and revalidation locks
+func (h *adminHandler) internal(key string) bool {
+	return strings.HasPrefix(key, GetTagKey(h.config.KeyPrefix, "")) || strings.HasSuffix(key, revalidateSuffix)
+}
+
+func (h *adminHandler) showStats(c echo.Context) error {
+	return c.JSON(http.StatusOK, h.config.Stats.Snapshot())
+}
+
+func (h *adminHandler) resetStats(c echo.Context) error {
+	h.config.Stats.Reset()
+	return c.NoContent(http.StatusNoContent)
+}
+
+func adminError(err error) error {
+	switch err {
+	case ErrCacheMiss:
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	case ErrNotSupport:
+		return echo.NewHTTPError(http.StatusNotImplemented, err.Error())
+	}
+	return err
+}
@@ -0,0 +1,148 @@
+package cache
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func initAdmin(store Store, stats *Stats) *echo.Echo {
+	e := echo.New()
+	api := e.Group("/api", CacheMiddlewareWithConfig(CacheMiddlewareConfig{Store: store, Stats: stats}))
+	api.GET("/v1/info", func(c echo.Context) error {
+		c.Response().Header().Set(HeaderCacheTag, "info, v1")
+		return c.String(http.StatusOK, "😁")
+	})
+	RegisterAdminWithConfig(e.Group("/admin"), AdminConfig{Store: store, Stats: stats})
+	return e
+}
+
+func adminRequest(e *echo.Echo, method string, target string, body interface{}) int {
+	req := httptest.NewRequest(method, target, nil)
+	res := httptest.NewRecorder()
+	e.ServeHTTP(res, req)
+	if body != nil {
+		_ = json.Unmarshal(res.Body.Bytes(), body)
+	}
+	return res.Code
+}
+
+func TestAdmin_EntryAndStats(t *testing.T) {
+	store := NewGoCacheStore(time.Minute, time.Minute)
+	e := initAdmin(store, &Stats{})
+
+	adminRequest(e, echo.GET, "/api/v1/info", nil)
+	adminRequest(e, echo.GET, "/api/v1/info", nil)
+
+	var stats StatsSnapshot
+	assert.Equal(t, http.StatusOK, adminRequest(e, echo.GET, "/admin/stats", &stats))
+	assert.Equal(t, StatsSnapshot{Hits: 1, Misses: 1, HitRate: 0.5}, stats)
+
+	key := DefaultCachePrefix + ":" + "%2Fapi%2Fv1%2Finfo"
+	var entry AdminEntry
+	assert.Equal(t, http.StatusOK, adminRequest(e, echo.GET, "/admin/entries?key="+url.QueryEscape(key), &entry))
+	assert.Equal(t, "/api/v1/info", entry.URI)
+	assert.Equal(t, http.StatusOK, entry.Status)
+	assert.Equal(t, len("😁"), entry.Size)
+	assert.Equal(t, []string{"info", "v1"}, entry.Tags)
+
+	assert.Equal(t, http.StatusNoContent, adminRequest(e, echo.DELETE, "/admin/entries?key="+url.QueryEscape(key), nil))
+	assert.Equal(t, http.StatusNotFound, adminRequest(e, echo.GET, "/admin/entries?key="+url.QueryEscape(key), nil))
+
+	assert.Equal(t, http.StatusNoContent, adminRequest(e, echo.DELETE, "/admin/stats", nil))
+	assert.Equal(t, http.StatusOK, adminRequest(e, echo.GET, "/admin/stats", &stats))
+	assert.Equal(t, StatsSnapshot{}, stats)
+}
+
+func TestAdmin_PurgeTag(t *testing.T) {
+	store := NewGoCacheStore(time.Minute, time.Minute)
+	e := initAdmin(store, nil)
+
+	adminRequest(e, echo.GET, "/api/v1/info", nil)
+
+	var keys struct{ Keys []string }
+	assert.Equal(t, http.StatusOK, adminRequest(e, echo.GET, "/admin/tags/v1", &keys))
+	assert.Equal(t, []string{DefaultCachePrefix + ":" + "%2Fapi%2Fv1%2Finfo"}, keys.Keys)
+
+	var purged struct{ Purged int }
+	assert.Equal(t, http.StatusOK, adminRequest(e, echo.DELETE, "/admin/tags/v1", &purged))
+	assert.Equal(t, 1, purged.Purged)
+
+	// Response is already gone, only the tag index is removed
+	assert.Equal(t, http.StatusOK, adminRequest(e, echo.DELETE, "/admin/tags/info", &purged))
+	assert.Equal(t, 0, purged.Purged)
+	assert.Equal(t, http.StatusNotFound, adminRequest(e, echo.GET, "/admin/tags/info", nil))
+}
+
+func TestAdmin_FlushNamespace(t *testing.T) {
+	store := NewNamespaceStore(NewGoCacheStore(time.Minute, time.Minute), "responses")
+	e := initAdmin(store, nil)
+
+	adminRequest(e, echo.GET, "/api/v1/info", nil)
+
+	key := DefaultCachePrefix + ":" + "%2Fapi%2Fv1%2Finfo"
+	assert.Equal(t, http.StatusOK, adminRequest(e, echo.GET, "/admin/entries?key="+url.QueryEscape(key), nil))
+	assert.Equal(t, http.StatusOK, adminRequest(e, echo.POST, "/admin/flush", nil))
+	assert.Equal(t, http.StatusNotFound, adminRequest(e, echo.GET, "/admin/entries?key="+url.QueryEscape(key), nil))
+}
+
+func TestAdmin_Keys(t *testing.T) {
+	store := NewGoCacheStore(time.Minute, time.Minute)
+	e := initAdmin(store, nil)
+
+	adminRequest(e, echo.GET, "/api/v1/info", nil)
+	adminRequest(e, echo.GET, "/api/v1/info?page=2", nil)
+	key := DefaultCachePrefix + ":" + "%2Fapi%2Fv1%2Finfo"
+	assert.NoError(t, store.Add(key+revalidateSuffix, true, time.Minute))
+
+	// Tag indexes and locks are not listed
+	var keys struct {
+		Keys      []string
+		Truncated bool
+	}
+	assert.Equal(t, http.StatusOK, adminRequest(e, echo.GET, "/admin/keys?prefix="+url.QueryEscape(DefaultCachePrefix), &keys))
+	assert.ElementsMatch(t, []string{key, key + "%3Fpage%3D2"}, keys.Keys)
+	assert.False(t, keys.Truncated)
+	assert.Equal(t, http.StatusOK, adminRequest(e, echo.GET, "/admin/keys?limit=1", &keys))
+	assert.Len(t, keys.Keys, 1)
+	assert.True(t, keys.Truncated)
+
+	// Not a cached response
+	tagKey := url.QueryEscape(GetTagKey(DefaultCachePrefix, "info"))
+	assert.Equal(t, http.StatusNotFound, adminRequest(e, echo.GET, "/admin/entries?key="+tagKey, nil))
+	assert.NoError(t, store.Set("other", []string{"value"}, DEFAULT))
+	assert.Equal(t, http.StatusBadRequest, adminRequest(e, echo.GET, "/admin/entries?key=other", nil))
+
+	var purged struct{ Purged int }
+	assert.Equal(t, http.StatusBadRequest, adminRequest(e, echo.DELETE, "/admin/keys", nil))
+	assert.Equal(t, http.StatusOK, adminRequest(e, echo.DELETE, "/admin/keys?prefix="+url.QueryEscape(key+"%3F"), &purged))
+	assert.Equal(t, 1, purged.Purged)
+	assert.Equal(t, http.StatusOK, adminRequest(e, echo.GET, "/admin/keys?prefix="+url.QueryEscape(DefaultCachePrefix), &keys))
+	assert.Equal(t, []string{key}, keys.Keys)
+
+	// Not supported by the store
+	e = initAdmin(NewMemcachedStore([]string{"127.0.0.1:11211"}, time.Minute), nil)
+	assert.Equal(t, http.StatusNotImplemented, adminRequest(e, echo.GET, "/admin/keys", nil))
+}
+
+func TestAdmin_FlushPrefix(t *testing.T) {
+	store := NewGoCacheStore(time.Minute, time.Minute)
+	e := initAdmin(store, nil)
+
+	adminRequest(e, echo.GET, "/api/v1/info", nil)
+	assert.NoError(t, store.Set("other", 1, DEFAULT))
+
+	// Every key under KeyPrefix, tag indexes included
+	var purged struct{ Purged int }
+	assert.Equal(t, http.StatusOK, adminRequest(e, echo.POST, "/admin/flush", &purged))
+	assert.Equal(t, 3, purged.Purged)
+	var value int
+	assert.NoError(t, store.Get("other", &value))
+	assert.Equal(t, http.StatusNotFound, adminRequest(e, echo.GET, "/admin/tags/info", nil))
+}
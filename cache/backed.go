@@ -0,0 +1,322 @@
+package cache
+
+import (
+	"sync"
+	"time"
+)
+
+type (
+	//Loader loads keys missing in the Store of a BackedStore from the backing source (database, API, ...)
+	Loader interface {
+		//Load returns the value of key, ErrCacheMiss if the source doesn't have it
+		Load(key string) (interface{}, error)
+	}
+
+	//Writer persists the writes of a BackedStore to the backing source
+	Writer interface {
+		//Write persists every key / value of values
+		Write(values map[string]interface{}) error
+		//Delete removes keys from the source
+		Delete(keys []string) error
+	}
+
+	//BackedStoreConfig Struct for Configure BackedStore
+	BackedStoreConfig struct {
+		//Store cache in front of the backing source (Default: gocache).
+		Store Store
+
+		//Loader loads the keys missing in Store, nil disables read-through (Default: nil).
+		Loader Loader
+
+		//Writer persists the writes, nil disables write-through / write-behind (Default: nil).
+		Writer Writer
+
+		//Expire ttl of the loaded values (Default: DEFAULT).
+		Expire time.Duration
+
+		//WriteBehind queues the writes and persists them by batch in background, otherwise they are persisted before
+		// returning (Default: false).
+		WriteBehind bool
+
+		//QueueSize max writes waiting to be persisted with WriteBehind, writes block while the queue is full (Default: 1000).
+		QueueSize int
+
+		//BatchSize max keys persisted at once with WriteBehind, successive writes of a key are merged (Default: 100).
+		BatchSize int
+
+		//FlushInterval max duration a write waits in the queue with WriteBehind (Default: 1s).
+		FlushInterval time.Duration
+
+		//MaxRetries retries of a batch failing to be persisted with WriteBehind, negative for none (Default: 3).
+		MaxRetries int
+
+		//RetryDelay delay before the first retry, doubled for every next one (Default: 100ms).
+		RetryDelay time.Duration
+
+		//ErrorHandler called with the keys of a batch dropped after MaxRetries with WriteBehind (Default: nil).
+		ErrorHandler func(keys []string, err error)
+	}
+
+	//BackedStore Wraps a Store in front of a backing source. Misses are loaded with the Loader, writes are
+	// persisted with the Writer synchronously (write-through) or in background (write-behind). Call Close on
+	// shutdown to persist the queued writes.
+	BackedStore struct {
+		store  Store
+		config BackedStoreConfig
+
+		// mu guards closed and the sends on queue
+		mu     sync.RWMutex
+		closed bool
+		queue  chan backedWrite
+		done   chan error
+	}
+
+	// backedWrite write waiting in the queue of a BackedStore
+	backedWrite struct {
+		key     string
+		value   interface{}
+		deleted bool
+	}
+)
+
+var (
+	//DefaultBackedStoreConfig default config of BackedStore
+	DefaultBackedStoreConfig = BackedStoreConfig{
+		Store:         defaultStore,
+		Expire:        DEFAULT,
+		QueueSize:     1000,
+		BatchSize:     100,
+		FlushInterval: time.Second,
+		MaxRetries:    3,
+		RetryDelay:    100 * time.Millisecond,
+	}
+)
+
+//NewBackedStore create a write-through BackedStore
+func NewBackedStore(store Store, loader Loader, writer Writer) *BackedStore {
+	config := DefaultBackedStoreConfig
+	config.Store = store
+	config.Loader = loader
+	config.Writer = writer
+	return NewBackedStoreWithConfig(config)
+}
+
+//NewBackedStoreWithConfig create a BackedStore, with WriteBehind it starts the goroutine persisting the writes
+func NewBackedStoreWithConfig(config BackedStoreConfig) *BackedStore {
+	// Defaults
+	if config.Store == nil {
+		config.Store = DefaultBackedStoreConfig.Store
+	}
+	if config.QueueSize <= 0 {
+		config.QueueSize = DefaultBackedStoreConfig.QueueSize
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = DefaultBackedStoreConfig.BatchSize
+	}
+	if config.FlushInterval <= 0 {
+		config.FlushInterval = DefaultBackedStoreConfig.FlushInterval
+	}
+	if config.MaxRetries == 0 {
+		config.MaxRetries = DefaultBackedStoreConfig.MaxRetries
+	}
+	if config.RetryDelay <= 0 {
+		config.RetryDelay = DefaultBackedStoreConfig.RetryDelay
+	}
+
+	c := &BackedStore{store: config.Store, config: config}
+	if config.WriteBehind && config.Writer != nil {
+		c.queue = make(chan backedWrite, config.QueueSize)
+		c.done = make(chan error, 1)
+		go c.writeBehind()
+	}
+	return c
+}
+
+//Get loads key with the Loader on a miss, concurrent loads of a key are shared like with Fetch
+func (c *BackedStore) Get(key string, value interface{}) error {
+	if c.config.Loader == nil {
+		return c.store.Get(key, value)
+	}
+
+	config := FetchConfig{Store: c.store, Expire: c.config.Expire}
+	return FetchWithConfig(config, key, func() (interface{}, error) {
+		return c.config.Loader.Load(key)
+	}, value)
+}
+
+func (c *BackedStore) Set(key string, value interface{}, expire time.Duration) error {
+	if err := c.store.Set(key, value, expire); err != nil {
+		return err
+	}
+	return c.persist(backedWrite{key: key, value: value})
+}
+
+func (c *BackedStore) Add(key string, value interface{}, expire time.Duration) error {
+	if err := c.store.Add(key, value, expire); err != nil {
+		return err
+	}
+	return c.persist(backedWrite{key: key, value: value})
+}
+
+func (c *BackedStore) Replace(key string, value interface{}, expire time.Duration) error {
+	if err := c.store.Replace(key, value, expire); err != nil {
+		return err
+	}
+	return c.persist(backedWrite{key: key, value: value})
+}
+
+//Delete removes key from the source even if it isn't in the Store
+func (c *BackedStore) Delete(key string) error {
+	err := c.store.Delete(key)
+	if err != nil && err != ErrCacheMiss {
+		return err
+	}
+	if c.config.Writer == nil {
+		return err
+	}
+	return c.persist(backedWrite{key: key, deleted: true})
+}
+
+//Increment persists the new value of key
+func (c *BackedStore) Increment(key string, delta uint64) (uint64, error) {
+	newValue, err := c.store.Increment(key, delta)
+	if err != nil {
+		return 0, err
+	}
+	return newValue, c.persist(backedWrite{key: key, value: newValue})
+}
+
+//Decrement persists the new value of key
+func (c *BackedStore) Decrement(key string, delta uint64) (uint64, error) {
+	newValue, err := c.store.Decrement(key, delta)
+	if err != nil {
+		return 0, err
+	}
+	return newValue, c.persist(backedWrite{key: key, value: newValue})
+}
+
+//Flush flushes the Store only, the backing source is left untouched
+func (c *BackedStore) Flush() error {
+	return c.store.Flush()
+}
+
+//Close persists the queued writes and stops the write-behind goroutine, writes fail with ErrClosed afterwards.
+// It returns the last error of the Writer.
+func (c *BackedStore) Close() error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil
+	}
+	c.closed = true
+	c.mu.Unlock()
+
+	if c.queue == nil {
+		return nil
+	}
+	close(c.queue)
+	return <-c.done
+}
+
+// persist writes through or queues write
+func (c *BackedStore) persist(write backedWrite) error {
+	if c.config.Writer == nil {
+		return nil
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.closed {
+		return ErrClosed
+	}
+
+	if c.queue != nil {
+		c.queue <- write
+		return nil
+	}
+
+	err := c.write(map[string]backedWrite{write.key: write})
+	if err != nil && !write.deleted {
+		// Don't keep a value the source doesn't have
+		_ = c.store.Delete(write.key)
+	}
+	return err
+}
+
+// writeBehind persists the queued writes by batch until the queue is closed
+func (c *BackedStore) writeBehind() {
+	ticker := time.NewTicker(c.config.FlushInterval)
+	defer ticker.Stop()
+
+	var lastErr error
+	batch := map[string]backedWrite{}
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := c.retry(batch); err != nil {
+			lastErr = err
+		}
+		batch = map[string]backedWrite{}
+	}
+
+	for {
+		select {
+		case write, ok := <-c.queue:
+			if !ok {
+				flush()
+				c.done <- lastErr
+				return
+			}
+			batch[write.key] = write
+			if len(batch) >= c.config.BatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// retry writes batch, retrying MaxRetries times
+func (c *BackedStore) retry(batch map[string]backedWrite) error {
+	delay := c.config.RetryDelay
+	err := c.write(batch)
+	for retry := 0; err != nil && retry < c.config.MaxRetries; retry++ {
+		time.Sleep(delay)
+		delay *= 2
+		err = c.write(batch)
+	}
+
+	if err != nil && c.config.ErrorHandler != nil {
+		keys := make([]string, 0, len(batch))
+		for key := range batch {
+			keys = append(keys, key)
+		}
+		c.config.ErrorHandler(keys, err)
+	}
+	return err
+}
+
+// write persists batch with the Writer, a batch holds one write by key
+func (c *BackedStore) write(batch map[string]backedWrite) error {
+	values := map[string]interface{}{}
+	var deleted []string
+	for key, write := range batch {
+		if write.deleted {
+			deleted = append(deleted, key)
+		} else {
+			values[key] = write.value
+		}
+	}
+
+	if len(values) > 0 {
+		if err := c.config.Writer.Write(values); err != nil {
+			return err
+		}
+	}
+	if len(deleted) > 0 {
+		return c.config.Writer.Delete(deleted)
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+package cache
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// source in memory Loader / Writer failing the next failures writes
+type source struct {
+	mu       sync.Mutex
+	values   map[string]interface{}
+	writes   int
+	failures int
+}
+
+func newSource() *source {
+	return &source{values: map[string]interface{}{}}
+}
+
+func (s *source) Load(key string) (interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	value, found := s.values[key]
+	if !found {
+		return nil, ErrCacheMiss
+	}
+	return value, nil
+}
+
+func (s *source) Write(values map[string]interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.writes++
+	if s.failures > 0 {
+		s.failures--
+		return errors.New("source unavailable")
+	}
+	for key, value := range values {
+		s.values[key] = value
+	}
+	return nil
+}
+
+func (s *source) Delete(keys []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, key := range keys {
+		delete(s.values, key)
+	}
+	return nil
+}
+
+func (s *source) get(key string) interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.values[key]
+}
+
+func TestBackedStore_ReadThrough(t *testing.T) {
+	cache := NewGoCacheStore(time.Minute, time.Minute)
+	source := newSource()
+	source.values["a"] = "value"
+	store := NewBackedStore(cache, source, nil)
+
+	var value string
+	assert.NoError(t, store.Get("a", &value))
+	assert.Equal(t, "value", value)
+	assert.Equal(t, ErrCacheMiss, store.Get("b", &value))
+
+	// Loaded value is cached
+	delete(source.values, "a")
+	value = ""
+	assert.NoError(t, store.Get("a", &value))
+	assert.Equal(t, "value", value)
+}
+
+func TestBackedStore_WriteThrough(t *testing.T) {
+	cache := NewGoCacheStore(time.Minute, time.Minute)
+	source := newSource()
+	store := NewBackedStore(cache, source, source)
+
+	assert.NoError(t, store.Set("a", "value", DEFAULT))
+	assert.Equal(t, "value", source.get("a"))
+
+	assert.NoError(t, store.Set("counter", 1, DEFAULT))
+	counter, err := store.Increment("counter", 2)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(3), counter)
+	assert.Equal(t, uint64(3), source.get("counter"))
+
+	// Not cached if it can't be persisted
+	source.failures = 1
+	assert.Error(t, store.Set("b", "value", DEFAULT))
+	var value string
+	assert.Equal(t, ErrCacheMiss, cache.Get("b", &value))
+
+	// Deleted from the source even if not cached
+	assert.NoError(t, cache.Delete("a"))
+	assert.NoError(t, store.Delete("a"))
+	assert.Nil(t, source.get("a"))
+	assert.NoError(t, store.Close())
+}
+
+func TestBackedStore_WriteBehind(t *testing.T) {
+	cache := NewGoCacheStore(time.Minute, time.Minute)
+	source := newSource()
+	store := NewBackedStoreWithConfig(BackedStoreConfig{
+		Store:         cache,
+		Loader:        source,
+		Writer:        source,
+		WriteBehind:   true,
+		BatchSize:     10,
+		FlushInterval: time.Hour,
+		RetryDelay:    time.Millisecond,
+	})
+
+	// Merged in one batch persisted on Close
+	source.failures = 2
+	for i := 0; i < 5; i++ {
+		assert.NoError(t, store.Set("a", i, DEFAULT))
+	}
+	assert.NoError(t, store.Set("b", "value", DEFAULT))
+	assert.NoError(t, store.Delete("b"))
+	assert.Nil(t, source.get("a"))
+
+	assert.NoError(t, store.Close())
+	assert.Equal(t, 4, source.get("a"))
+	assert.Nil(t, source.get("b"))
+	assert.Equal(t, 3, source.writes)
+
+	assert.Equal(t, ErrClosed, store.Set("a", 5, DEFAULT))
+	assert.NoError(t, store.Close())
+}
+
+func TestBackedStore_WriteBehindErrorHandler(t *testing.T) {
+	source := newSource()
+	source.failures = 10
+
+	var mu sync.Mutex
+	var dropped []string
+	store := NewBackedStoreWithConfig(BackedStoreConfig{
+		Store:         NewGoCacheStore(time.Minute, time.Minute),
+		Writer:        source,
+		WriteBehind:   true,
+		BatchSize:     2,
+		FlushInterval: 10 * time.Millisecond,
+		MaxRetries:    1,
+		RetryDelay:    time.Millisecond,
+		ErrorHandler: func(keys []string, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			dropped = append(dropped, keys...)
+		},
+	})
+
+	assert.NoError(t, store.Set("a", 1, DEFAULT))
+	assert.NoError(t, store.Set("b", 2, DEFAULT))
+	assert.NoError(t, store.Set("c", 3, DEFAULT))
+	assert.EqualError(t, store.Close(), "source unavailable")
+
+	sort.Strings(dropped)
+	assert.Equal(t, []string{"a", "b", "c"}, dropped)
+	assert.Equal(t, 4, source.writes)
+}
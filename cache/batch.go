@@ -0,0 +1,52 @@
+package cache
+
+import (
+	"time"
+)
+
+// GetMulti fills the pointers of values with the value of their key, keys not found are removed from values
+// Use BatchStore.GetMulti if store implements it, Get for every key otherwise
+func GetMulti(store Store, values map[string]interface{}) error {
+	if batch, ok := store.(BatchStore); ok {
+		return batch.GetMulti(values)
+	}
+
+	for key, value := range values {
+		if err := store.Get(key, value); err == ErrCacheMiss {
+			delete(values, key)
+		} else if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetMulti stores every key / value of values
+// Use BatchStore.SetMulti if store implements it, Set for every key otherwise
+func SetMulti(store Store, values map[string]interface{}, expire time.Duration) error {
+	if batch, ok := store.(BatchStore); ok {
+		return batch.SetMulti(values, expire)
+	}
+
+	for key, value := range values {
+		if err := store.Set(key, value, expire); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteMulti removes every key, missing keys are ignored
+// Use BatchStore.DeleteMulti if store implements it, Delete for every key otherwise
+func DeleteMulti(store Store, keys ...string) error {
+	if batch, ok := store.(BatchStore); ok {
+		return batch.DeleteMulti(keys...)
+	}
+
+	for _, key := range keys {
+		if err := store.Delete(key); err != nil && err != ErrCacheMiss {
+			return err
+		}
+	}
+	return nil
+}
@@ -2,6 +2,7 @@ package cache
 
 import (
 	"bytes"
+	"context"
 	"crypto/sha1"
 	"errors"
 	"io"
@@ -21,6 +22,19 @@ const (
 	DEFAULT = time.Duration(0)
 	//NEVER Duration never remove value of the cache
 	NEVER = time.Duration(-1)
+
+	//MethodPurge HTTP method used to remove the cached response of the request URI
+	MethodPurge = "PURGE"
+	//MethodBan HTTP method used to invalidate every cached response matching HeaderBanRegex or HeaderBanPrefix.
+	// Bans are kept in memory, with several instances a BAN only reaches the instance receiving it.
+	MethodBan = "BAN"
+
+	//HeaderBanRegex header holding the regular expression matched against request URIs by a BAN request
+	HeaderBanRegex = "X-Ban-Regex"
+	//HeaderBanPrefix header holding the request URI prefix matched by a BAN request
+	HeaderBanPrefix = "X-Ban-Prefix"
+	//HeaderCacheTag response header holding the comma separated tags of a response, used by PurgeTag
+	HeaderCacheTag = "Cache-Tag"
 )
 
 type (
@@ -31,11 +45,16 @@ type (
 
 		//ContextKey defines the name you use to get the store from echo.Context (Default: cache.DefaultCacheContextKey).
 		ContextKey string
+
+		//ReadYourWrites wraps the context of each request with WithReadYourWrites, a RedisStore with replicas then
+		// reads from the primary once the request wrote to it (Default: false).
+		ReadYourWrites bool
 	}
 
 	//CacheMiddlewareConfig Struct for Configure CacheMiddleware
 	CacheMiddlewareConfig struct {
-		//Store defines which type of cache you use (Default: gocache).
+		//Store defines which type of cache you use, a ContextStore gets the request context to get and store
+		// responses (Default: gocache).
 		Store Store
 
 		//KeyPrefix default cache key prefix used for stored responses (Default: cache.DefaultResponseCachePrefix).
@@ -46,8 +65,25 @@ type (
 
 		//Expire ttl for cache value
 		Expire time.Duration
+
+		//PurgeAuthorizer defines a function to allow PURGE and BAN requests, return true to allow. When nil,
+		// PURGE and BAN requests are not intercepted and go to the next handler like any other method (Default: nil).
+		PurgeAuthorizer Authorizer
+
+		//Stats collects hit / miss counters of the middleware, share it with AdminConfig to expose them (Default: nil).
+		Stats *Stats
+
+		//BackgroundRevalidate revalidates responses marked stale by SoftPurge in background, every request get the
+		// stale response meanwhile. Otherwise the first request revalidates it and the others get the stale response (Default: false).
+		BackgroundRevalidate bool
+
+		//RevalidateTimeout max duration of a stale response revalidation, another request can revalidate it after that (Default: 10s).
+		RevalidateTimeout time.Duration
 	}
 
+	//Authorizer defines a function to authorize a request. Like emw.Skipper, it only receives the echo.Context.
+	Authorizer func(c echo.Context) bool
+
 	//CacheStore Interface for every Cache (GoCache, Redis, ...)
 	Store interface {
 		Get(key string, value interface{}) error
@@ -59,6 +95,85 @@ type (
 		Decrement(key string, data uint64) (uint64, error)
 		Flush() error
 	}
+
+	//ContextStore Store taking a context.Context, operations return the error of ctx once it is done.
+	// Use NewContextStore to get one from any Store.
+	ContextStore interface {
+		Store
+		GetContext(ctx context.Context, key string, value interface{}) error
+		SetContext(ctx context.Context, key string, value interface{}, expire time.Duration) error
+		AddContext(ctx context.Context, key string, value interface{}, expire time.Duration) error
+		ReplaceContext(ctx context.Context, key string, data interface{}, expire time.Duration) error
+		DeleteContext(ctx context.Context, key string) error
+		IncrementContext(ctx context.Context, key string, data uint64) (uint64, error)
+		DecrementContext(ctx context.Context, key string, data uint64) (uint64, error)
+		FlushContext(ctx context.Context) error
+	}
+
+	//ScanStore Store able to iterate over the keys it holds
+	ScanStore interface {
+		Store
+		//Scan calls fn for every key starting with prefix until fn returns false
+		Scan(prefix string, fn func(key string) bool) error
+	}
+
+	//BatchStore Store able to handle several keys in one round trip
+	BatchStore interface {
+		Store
+		//GetMulti fills the pointers of values with the value of their key, keys not found are removed from values
+		GetMulti(values map[string]interface{}) error
+		//SetMulti stores every key / value of values
+		SetMulti(values map[string]interface{}, expire time.Duration) error
+		//DeleteMulti removes every key, missing keys are ignored
+		DeleteMulti(keys ...string) error
+	}
+
+	//TTLStore Store able to read and extend the ttl of a key without rewriting its value
+	TTLStore interface {
+		Store
+		//TTL returns the remaining ttl of key, NEVER if key doesn't expire and ErrCacheMiss if key doesn't exist
+		TTL(key string) (time.Duration, error)
+		//Touch sets the ttl of key to expire, it returns ErrCacheMiss if key doesn't exist
+		Touch(key string, expire time.Duration) error
+	}
+
+	//ResponseMetaStore Store able to get a cached response without reading its body, used for HEAD and conditional
+	// requests and by the admin API
+	ResponseMetaStore interface {
+		Store
+		//GetResponseMeta gets the ResponseCache stored under key like Get, without its Data. It returns ErrNotSupport
+		// if the response isn't stored in a way allowing it.
+		GetResponseMeta(ctx context.Context, key string, cache *ResponseCache) error
+	}
+
+	//LeaseStore Store tracking stale values and handing out their revalidation itself, like the meta commands of
+	// memcached. CacheMiddleware and SoftPurge use it instead of ResponseCache.Stale and a revalidation lock key.
+	LeaseStore interface {
+		Store
+		//GetLease gets the value of key like Get. stale is true if the value was marked stale by Invalidate, win is
+		// true for the single caller which has to store it again, the others keep getting the value meanwhile. A
+		// value may also be won ahead of its expiration. If the winner doesn't store it, the value is served until
+		// it expires. A missing key may be won too, with ErrCacheMiss, the others then wait for its value, or for
+		// its deletion if the winner doesn't store it.
+		GetLease(ctx context.Context, key string, value interface{}) (stale bool, win bool, err error)
+		//Invalidate marks the value of key stale instead of deleting it, it keeps its ttl
+		Invalidate(key string) error
+	}
+
+	//CASToken opaque version of a value returned by CASStore.Gets
+	CASToken struct {
+		version interface{}
+	}
+
+	//CASStore Store supporting optimistic concurrency with compare-and-swap
+	CASStore interface {
+		Store
+		//Gets gets the value of key like Get and returns its version
+		Gets(key string, value interface{}) (CASToken, error)
+		//CompareAndSwap stores value only if key wasn't modified since Gets returned token. It returns
+		// ErrCASConflict if key was modified and ErrCacheMiss if key was deleted or expired.
+		CompareAndSwap(key string, value interface{}, token CASToken, expire time.Duration) error
+	}
 )
 
 var (
@@ -78,15 +193,19 @@ var (
 	}
 
 	DefaultCacheMiddlewareConfig = CacheMiddlewareConfig{
-		Store:     defaultStore,
-		KeyPrefix: DefaultCachePrefix,
-		Skipper:   defaultSkipper,
-		Expire:    DEFAULT,
+		Store:             defaultStore,
+		KeyPrefix:         DefaultCachePrefix,
+		Skipper:           defaultSkipper,
+		Expire:            DEFAULT,
+		RevalidateTimeout: 10 * time.Second,
 	}
 
-	ErrCacheMiss  = errors.New("cache: key not found")
-	ErrNotStored  = errors.New("cache: not stored")
-	ErrNotSupport = errors.New("cache: not support")
+	ErrCacheMiss   = errors.New("cache: key not found")
+	ErrNotStored   = errors.New("cache: not stored")
+	ErrNotSupport  = errors.New("cache: not support")
+	ErrCASConflict = errors.New("cache: compare-and-swap conflict")
+	ErrClosed      = errors.New("cache: store closed")
+	ErrNoShard     = errors.New("cache: no shard")
 )
 
 //StoreMiddleware for provide Store to all route using echo.Context#Set()
@@ -109,6 +228,9 @@ func StoreMiddlewareWithConfig(config StoreMiddlewareConfig) echo.MiddlewareFunc
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
 			c.Set(config.ContextKey, config.Store)
+			if config.ReadYourWrites {
+				c.SetRequest(c.Request().WithContext(WithReadYourWrites(c.Request().Context())))
+			}
 			return next(c)
 		}
 	}
@@ -123,46 +245,11 @@ func CacheMiddleware() echo.MiddlewareFunc {
 //CacheMiddlewareWithConfig for caching response of all route and return cache if previous call is stored
 // Use it in middleware definition
 func CacheMiddlewareWithConfig(config CacheMiddlewareConfig) echo.MiddlewareFunc {
-	// Defaults
-	if config.Store == nil {
-		config.Store = DefaultCacheMiddlewareConfig.Store
-	}
-	if config.KeyPrefix == "" {
-		config.KeyPrefix = DefaultCacheMiddlewareConfig.KeyPrefix
-	}
-	if config.Skipper == nil {
-		config.Skipper = DefaultCacheMiddlewareConfig.Skipper
-	}
-	if config.Expire == time.Duration(0) {
-		config.Expire = DefaultCacheMiddlewareConfig.Expire
-	}
+	cache := newResponseCacher(config)
 
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
-			if config.Skipper(c) {
-				return next(c)
-			}
-
-			var cache ResponseCache
-			key := GetKey(config.KeyPrefix, c.Request())
-
-			if err := config.Store.Get(key, &cache); err != nil {
-				// Inject Wrapped Writer
-				writer := newCachedWriter(config.Store, config.Expire, c.Response().Writer, c.Response(), key)
-				c.Response().Writer = writer
-				return next(c)
-			} else {
-				for k, vals := range cache.Header {
-					for _, v := range vals {
-						if c.Response().Header().Get(k) == "" {
-							c.Response().Header().Add(k, v)
-						}
-					}
-				}
-				c.Response().WriteHeader(cache.Status)
-				_, _ = c.Response().Write(cache.Data)
-				return nil
-			}
+			return cache.serve(c, next)
 		}
 	}
 }
@@ -176,6 +263,22 @@ func CacheHandler(handle echo.HandlerFunc) echo.HandlerFunc {
 //CacheHandlerWithConfig for caching response of one route and return cache if previous call is stored
 // Use it in route definition
 func CacheHandlerWithConfig(config CacheMiddlewareConfig, handle echo.HandlerFunc) echo.HandlerFunc {
+	cache := newResponseCacher(config)
+
+	return func(c echo.Context) error {
+		return cache.serve(c, handle)
+	}
+}
+
+// responseCacher holds the state shared by every request going through one CacheMiddleware / CacheHandler
+type responseCacher struct {
+	config CacheMiddlewareConfig
+	// store config.Store taking the request context, used to get and store responses
+	store ContextStore
+	bans  *banList
+}
+
+func newResponseCacher(config CacheMiddlewareConfig) *responseCacher {
 	// Defaults
 	if config.Store == nil {
 		config.Store = DefaultCacheMiddlewareConfig.Store
@@ -189,31 +292,141 @@ func CacheHandlerWithConfig(config CacheMiddlewareConfig, handle echo.HandlerFun
 	if config.Expire == time.Duration(0) {
 		config.Expire = DefaultCacheMiddlewareConfig.Expire
 	}
+	if config.PurgeAuthorizer == nil {
+		config.PurgeAuthorizer = DefaultCacheMiddlewareConfig.PurgeAuthorizer
+	}
+	if config.RevalidateTimeout == time.Duration(0) {
+		config.RevalidateTimeout = DefaultCacheMiddlewareConfig.RevalidateTimeout
+	}
 
-	return func(c echo.Context) error {
-		if config.Skipper(c) {
-			return handle(c)
+	return &responseCacher{config: config, store: NewContextStore(config.Store), bans: newBanList(config.Expire)}
+}
+
+func (r *responseCacher) serve(c echo.Context, next echo.HandlerFunc) error {
+	if r.config.Skipper(c) {
+		return next(c)
+	}
+
+	if r.config.PurgeAuthorizer != nil {
+		switch c.Request().Method {
+		case MethodPurge:
+			return r.handlePurge(c)
+		case MethodBan:
+			return r.handleBan(c)
+		}
+	}
+
+	var cache ResponseCache
+	request := c.Request()
+	key := GetKey(r.config.KeyPrefix, request)
+
+	ctx := request.Context()
+	leaseStore, leased := r.config.Store.(LeaseStore)
+	var err error
+	var win bool
+	switch {
+	case leased:
+		// Even for HEAD and conditional requests, the store hands out the revalidation with the value
+		var stale bool
+		stale, win, err = leaseStore.GetLease(ctx, key, &cache)
+		cache.Stale = cache.Stale || stale
+	case request.Method == http.MethodHead || conditional(request):
+		// The body may not be needed
+		err = GetResponseMeta(ctx, r.store, key, &cache)
+	default:
+		err = r.store.GetContext(ctx, key, &cache)
+	}
+	if err == nil && r.bans.banned(&cache) {
+		// Stored before a matching BAN, drop it and refresh it from the handler
+		_ = r.store.DeleteContext(ctx, key)
+		err = ErrCacheMiss
+	}
+
+	if err != nil {
+		r.config.Stats.miss()
+		if leased && win {
+			// The others wait for the response of this request, release the key if it doesn't store one
+			stored, err := r.callHandler(c, next, key)
+			if !stored {
+				_ = r.config.Store.Delete(key)
+			}
+			return err
 		}
+		return r.serveHandler(c, next, key)
+	}
+
+	if leased && win {
+		// The store handed out the revalidation to this request
+		return r.revalidate(c, next, key, &cache, func() {})
+	}
+	if !cache.Stale && (request.Method == http.MethodHead || notModified(request, &cache)) {
+		r.config.Stats.hit()
+		return r.serveHeader(c, &cache)
+	}
+
+	if len(cache.Data) < cache.Size {
+		// Only the metadata was read
+		if err := r.store.GetContext(ctx, key, &cache); err != nil {
+			r.config.Stats.miss()
+			return r.serveHandler(c, next, key)
+		}
+	}
+
+	if leased && cache.Stale {
+		r.config.Stats.stale()
+		return r.serveCache(c, &cache)
+	}
+	if cache.Stale {
+		return r.serveStale(c, next, key, &cache)
+	}
+
+	r.config.Stats.hit()
+	return r.serveCache(c, &cache)
+}
+
+// serveHandler calls next with a wrapped writer storing the response
+func (r *responseCacher) serveHandler(c echo.Context, next echo.HandlerFunc, key string) error {
+	_, err := r.callHandler(c, next, key)
+	return err
+}
+
+// callHandler calls next like serveHandler and returns true if the response was stored, a response without body
+// isn't
+func (r *responseCacher) callHandler(c echo.Context, next echo.HandlerFunc, key string) (bool, error) {
+	// Inject Wrapped Writer
+	writer := newCachedWriter(r, c.Request().Context(), c.Response().Writer, c.Response(), key, c.Request().RequestURI)
+	c.Response().Writer = writer
+	err := next(c)
+	return writer.stored, err
+}
+
+// serveCache writes the cached response
+func (r *responseCacher) serveCache(c echo.Context, cache *ResponseCache) error {
+	writeHeader(c, cache.Header)
+	c.Response().WriteHeader(cache.Status)
+	_, _ = c.Response().Write(cache.Data)
+	return nil
+}
+
+// serveHeader writes the cached response without its body, with 304 Not Modified if the request is conditional
+func (r *responseCacher) serveHeader(c echo.Context, cache *ResponseCache) error {
+	writeHeader(c, cache.Header)
+	if notModified(c.Request(), cache) {
+		c.Response().Header().Del(echo.HeaderContentLength)
+		c.Response().WriteHeader(http.StatusNotModified)
+		return nil
+	}
+	c.Response().WriteHeader(cache.Status)
+	return nil
+}
 
-		var cache ResponseCache
-		key := GetKey(config.KeyPrefix, c.Request())
-
-		if err := config.Store.Get(key, &cache); err != nil {
-			// Inject Wrapped Writer
-			writer := newCachedWriter(config.Store, config.Expire, c.Response().Writer, c.Response(), key)
-			c.Response().Writer = writer
-			return handle(c)
-		} else {
-			for k, vals := range cache.Header {
-				for _, v := range vals {
-					if c.Response().Header().Get(k) == "" {
-						c.Response().Header().Add(k, v)
-					}
-				}
+// writeHeader adds the cached header to the response, headers already set are kept
+func writeHeader(c echo.Context, header http.Header) {
+	for k, vals := range header {
+		for _, v := range vals {
+			if c.Response().Header().Get(k) == "" {
+				c.Response().Header().Add(k, v)
 			}
-			c.Response().WriteHeader(cache.Status)
-			_, _ = c.Response().Write(cache.Data)
-			return nil
 		}
 	}
 }
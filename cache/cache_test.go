@@ -1,9 +1,11 @@
 package cache
 
 import (
+	"context"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/jsdidierlaurent/echo-middleware/cache/mocks"
 	"github.com/stretchr/testify/assert"
@@ -116,3 +118,41 @@ func TestStoreHandler(t *testing.T) {
 
 	assert.NoError(t, handle(ctx))
 }
+
+func TestStoreHandler_ReadYourWrites(t *testing.T) {
+	ctx, _ := initEcho()
+
+	cm := StoreMiddlewareWithConfig(StoreMiddlewareConfig{Store: new(mocks.Store), ReadYourWrites: true})
+
+	handle := cm(echo.HandlerFunc(func(c echo.Context) error {
+		requestContext := c.Request().Context()
+		assert.False(t, readsPrimary(requestContext))
+		wrote(requestContext)
+		assert.True(t, readsPrimary(requestContext))
+		return c.NoContent(http.StatusOK)
+	}))
+
+	assert.NoError(t, handle(ctx))
+}
+
+func TestNewContextStore(t *testing.T) {
+	// Stores supporting contexts are returned as is, see TestRedisCache_ContextDeadline
+	redisStore := NewRedisCache("localhost:6379", "", time.Hour)
+	assert.True(t, NewContextStore(redisStore) == ContextStore(redisStore))
+
+	// The others are wrapped
+	goCacheStore := NewGoCacheStore(time.Hour, time.Minute)
+	store := NewContextStore(goCacheStore)
+	_, wrapped := store.(*contextStore)
+	assert.True(t, wrapped)
+	testContext(t, func(*testing.T, time.Duration) Store { return NewGoCacheStore(time.Hour, time.Minute) })
+
+	// A done context stops the operations before the wrapped store
+	var get int
+	assert.NoError(t, store.SetContext(context.Background(), "int", 1, DEFAULT))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Equal(t, context.Canceled, store.ReplaceContext(ctx, "int", 2, DEFAULT))
+	assert.NoError(t, goCacheStore.Get("int", &get))
+	assert.Equal(t, 1, get)
+}
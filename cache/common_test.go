@@ -1,7 +1,12 @@
 package cache
 
 import (
+	"context"
+	"io"
+	"io/ioutil"
 	"math"
+	"net"
+	"sort"
 	"sync"
 	"testing"
 	"time"
@@ -93,6 +98,22 @@ func expiration(t *testing.T, newCache cacheFactory) {
 	wg.Wait()
 }
 
+func millisecondExpiration(t *testing.T, newCache cacheFactory) {
+	cache := newCache(t, time.Hour)
+
+	set, get := 10, 0
+	assert.NoError(t, cache.Set("int", set, 300*time.Millisecond))
+	assert.NoError(t, cache.Get("int", &get))
+	assert.Equal(t, set, get)
+	time.Sleep(500 * time.Millisecond)
+	assert.Equal(t, ErrCacheMiss, cache.Get("int", &get))
+
+	// Less than a millisecond still expires
+	assert.NoError(t, cache.Set("int", set, time.Microsecond))
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, ErrCacheMiss, cache.Get("int", &get))
+}
+
 func emptyCache(t *testing.T, newCache cacheFactory) {
 	var err error
 	cache := newCache(t, time.Hour)
@@ -162,6 +183,255 @@ func testAdd(t *testing.T, newCache cacheFactory) {
 	assert.Equal(t, 3, i)
 }
 
+func testNamespaceFlush(t *testing.T, newCache cacheFactory) {
+	cache := newCache(t, time.Hour)
+	ns1, ns2 := NewNamespaceStore(cache, "ns1"), NewNamespaceStore(cache, "ns2")
+
+	// Flush an empty namespace
+	assert.NoError(t, ns1.Flush())
+
+	assert.NoError(t, cache.Set("other", "foo", DEFAULT))
+	assert.NoError(t, ns1.Set("value", "foo", DEFAULT))
+	assert.NoError(t, ns2.Set("value", "foo", DEFAULT))
+
+	// Only ns1 is flushed
+	assert.NoError(t, ns1.Flush())
+
+	var get string
+	assert.Equal(t, ErrCacheMiss, ns1.Get("value", &get))
+	assert.NoError(t, ns2.Get("value", &get))
+	assert.NoError(t, cache.Get("other", &get))
+
+	// Store again in the new generation
+	assert.NoError(t, ns1.Set("value", "bar", DEFAULT))
+	assert.NoError(t, ns1.Get("value", &get))
+	assert.Equal(t, "bar", get)
+}
+
+func testBatch(t *testing.T, newCache cacheFactory) {
+	cache := newCache(t, time.Hour)
+
+	// Operations on nothing
+	assert.NoError(t, GetMulti(cache, map[string]interface{}{}))
+	assert.NoError(t, SetMulti(cache, map[string]interface{}{}, DEFAULT))
+	assert.NoError(t, DeleteMulti(cache))
+
+	assert.NoError(t, SetMulti(cache, map[string]interface{}{"int": 1, "string": "foo"}, DEFAULT))
+	assert.NoError(t, cache.Set("other", "bar", DEFAULT))
+
+	var i int
+	var s1, s2 string
+	values := map[string]interface{}{"int": &i, "string": &s1, "notexist": &s2}
+	assert.NoError(t, GetMulti(cache, values))
+	assert.Len(t, values, 2)
+	assert.Equal(t, 1, i)
+	assert.Equal(t, "foo", s1)
+
+	assert.NoError(t, DeleteMulti(cache, "int", "string", "notexist"))
+	values = map[string]interface{}{"int": &i, "string": &s1, "other": &s2}
+	assert.NoError(t, GetMulti(cache, values))
+	assert.Len(t, values, 1)
+	assert.Equal(t, "bar", s2)
+}
+
+func testCAS(t *testing.T, newCache cacheFactory) {
+	cache := newCache(t, time.Hour).(CASStore)
+
+	var get int
+	_, err := cache.Gets("int", &get)
+	assert.Equal(t, ErrCacheMiss, err)
+
+	// Swap an unmodified value
+	assert.NoError(t, cache.Set("int", 1, DEFAULT))
+	token, err := cache.Gets("int", &get)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, get)
+	assert.NoError(t, cache.CompareAndSwap("int", 2, token, DEFAULT))
+
+	// Token is outdated by the swap
+	assert.Equal(t, ErrCASConflict, cache.CompareAndSwap("int", 3, token, DEFAULT))
+	assert.NoError(t, cache.Get("int", &get))
+	assert.Equal(t, 2, get)
+
+	// Token is outdated by a Set
+	token, err = cache.Gets("int", &get)
+	assert.NoError(t, err)
+	assert.NoError(t, cache.Set("int", 4, DEFAULT))
+	assert.Equal(t, ErrCASConflict, cache.CompareAndSwap("int", 5, token, DEFAULT))
+
+	// Key is deleted
+	token, err = cache.Gets("int", &get)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, get)
+	assert.NoError(t, cache.Delete("int"))
+	assert.Equal(t, ErrCacheMiss, cache.CompareAndSwap("int", 6, token, DEFAULT))
+}
+
+func testTTL(t *testing.T, newCache cacheFactory) {
+	cache := newCache(t, time.Hour).(TTLStore)
+
+	_, err := cache.TTL("int")
+	assert.Equal(t, ErrCacheMiss, err)
+	assert.Equal(t, ErrCacheMiss, cache.Touch("int", time.Minute))
+
+	// Default expiration
+	assert.NoError(t, cache.Set("int", 1, DEFAULT))
+	ttl, err := cache.TTL("int")
+	assert.NoError(t, err)
+	assert.True(t, ttl > 59*time.Minute && ttl <= time.Hour, "ttl: %s", ttl)
+
+	// Touch keeps the value
+	assert.NoError(t, cache.Touch("int", time.Minute))
+	ttl, err = cache.TTL("int")
+	assert.NoError(t, err)
+	assert.True(t, ttl > 59*time.Second && ttl <= time.Minute, "ttl: %s", ttl)
+	var get int
+	assert.NoError(t, cache.Get("int", &get))
+	assert.Equal(t, 1, get)
+
+	// Never expire
+	assert.NoError(t, cache.Touch("int", NEVER))
+	ttl, err = cache.TTL("int")
+	assert.NoError(t, err)
+	assert.Equal(t, NEVER, ttl)
+	assert.NoError(t, cache.Touch("int", NEVER))
+
+	testTouch(t, cache)
+}
+
+func testTouch(t *testing.T, cache TTLStore) {
+	assert.NoError(t, cache.Set("touch", 1, time.Hour))
+	assert.NoError(t, cache.Touch("touch", time.Second))
+	time.Sleep(2 * time.Second)
+
+	var get int
+	assert.Equal(t, ErrCacheMiss, cache.Get("touch", &get))
+	assert.Equal(t, ErrCacheMiss, cache.Touch("touch", time.Minute))
+}
+
+func testContext(t *testing.T, newCache cacheFactory) {
+	cache := NewContextStore(newCache(t, time.Hour))
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	var get int
+	assert.NoError(t, cache.SetContext(ctx, "int", 1, DEFAULT))
+	assert.NoError(t, cache.GetContext(ctx, "int", &get))
+	assert.Equal(t, 1, get)
+	assert.Equal(t, ErrNotStored, cache.AddContext(ctx, "int", 2, DEFAULT))
+	assert.NoError(t, cache.ReplaceContext(ctx, "int", 2, DEFAULT))
+	newValue, err := cache.IncrementContext(ctx, "int", 3)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(5), newValue)
+	newValue, err = cache.DecrementContext(ctx, "int", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(4), newValue)
+
+	// Done context
+	cancel()
+	assert.Equal(t, context.Canceled, cache.GetContext(ctx, "int", &get))
+	assert.Equal(t, context.Canceled, cache.SetContext(ctx, "int", 6, DEFAULT))
+	assert.Equal(t, context.Canceled, cache.DeleteContext(ctx, "int"))
+	_, err = cache.IncrementContext(ctx, "int", 1)
+	assert.Equal(t, context.Canceled, err)
+
+	expired, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, cache.AddContext(expired, "other", 1, DEFAULT))
+
+	// Nothing changed
+	assert.NoError(t, cache.GetContext(context.Background(), "int", &get))
+	assert.Equal(t, 4, get)
+	assert.Equal(t, ErrCacheMiss, cache.GetContext(context.Background(), "other", &get))
+}
+
+// silentServer accepts connections and reads their commands without ever replying
+func silentServer(t *testing.T) (addr string, stop func()) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var mu sync.Mutex
+	var conns []net.Conn
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			conns = append(conns, conn)
+			mu.Unlock()
+			go func() { _, _ = io.Copy(ioutil.Discard, conn) }()
+		}
+	}()
+	return listener.Addr().String(), func() {
+		_ = listener.Close()
+		mu.Lock()
+		defer mu.Unlock()
+		for _, conn := range conns {
+			_ = conn.Close()
+		}
+	}
+}
+
+// testDeadline checks that the commands of a cache connected to a silentServer return at the deadline of their
+// context, not at the timeout of the store
+func testDeadline(t *testing.T, cache ContextStore) {
+	var get int
+	for _, command := range []func(ctx context.Context) error{
+		func(ctx context.Context) error { return cache.GetContext(ctx, "int", &get) },
+		func(ctx context.Context) error { return cache.SetContext(ctx, "int", 1, DEFAULT) },
+	} {
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		start := time.Now()
+		assert.Equal(t, context.DeadlineExceeded, command(ctx))
+		elapsed := time.Since(start)
+		cancel()
+		assert.True(t, elapsed >= 150*time.Millisecond, "returned after %s", elapsed)
+		assert.True(t, elapsed < time.Second, "returned after %s", elapsed)
+	}
+}
+
+func testScan(t *testing.T, newCache cacheFactory) {
+	cache := newCache(t, time.Hour).(ScanStore)
+	scan := func(prefix string) []string {
+		var keys []string
+		assert.NoError(t, cache.Scan(prefix, func(key string) bool {
+			keys = append(keys, key)
+			return true
+		}))
+		sort.Strings(keys)
+		return keys
+	}
+
+	assert.Empty(t, scan("scan:"))
+
+	assert.NoError(t, cache.Set("scan:a", 1, DEFAULT))
+	assert.NoError(t, cache.Set("scan:b", 2, DEFAULT))
+	assert.NoError(t, cache.Set("scan:[*]", 3, DEFAULT))
+	assert.NoError(t, cache.Set("other:a", 4, DEFAULT))
+	assert.Equal(t, []string{"scan:[*]", "scan:a", "scan:b"}, scan("scan:"))
+	assert.Equal(t, []string{"scan:[*]"}, scan("scan:[*"))
+
+	// Stop on false
+	calls := 0
+	assert.NoError(t, cache.Scan("scan:", func(key string) bool {
+		calls++
+		return false
+	}))
+	assert.Equal(t, 1, calls)
+
+	assert.NoError(t, cache.Delete("scan:a"))
+	assert.Equal(t, []string{"scan:[*]", "scan:b"}, scan("scan:"))
+
+	purged, err := PurgePrefix(cache, "scan:")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, purged)
+	assert.Empty(t, scan("scan:"))
+	assert.Equal(t, []string{"other:a"}, scan("other:"))
+}
+
 func parallel(wg *sync.WaitGroup, handler func()) {
 	go func() {
 		handler()
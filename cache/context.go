@@ -0,0 +1,76 @@
+package cache
+
+import (
+	"context"
+	"time"
+)
+
+// contextStore adapts a Store to ContextStore, ctx is only checked before calling the Store
+type contextStore struct {
+	Store
+}
+
+// NewContextStore returns store if it implements ContextStore, otherwise wraps it to check the context before
+// every operation. Deadlines can't interrupt an operation of a wrapped Store.
+func NewContextStore(store Store) ContextStore {
+	if contextStore, ok := store.(ContextStore); ok {
+		return contextStore
+	}
+	return &contextStore{store}
+}
+
+func (c *contextStore) GetContext(ctx context.Context, key string, value interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return c.Get(key, value)
+}
+
+func (c *contextStore) SetContext(ctx context.Context, key string, value interface{}, expire time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return c.Set(key, value, expire)
+}
+
+func (c *contextStore) AddContext(ctx context.Context, key string, value interface{}, expire time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return c.Add(key, value, expire)
+}
+
+func (c *contextStore) ReplaceContext(ctx context.Context, key string, value interface{}, expire time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return c.Replace(key, value, expire)
+}
+
+func (c *contextStore) DeleteContext(ctx context.Context, key string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return c.Delete(key)
+}
+
+func (c *contextStore) IncrementContext(ctx context.Context, key string, delta uint64) (uint64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.Increment(key, delta)
+}
+
+func (c *contextStore) DecrementContext(ctx context.Context, key string, delta uint64) (uint64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.Decrement(key, delta)
+}
+
+func (c *contextStore) FlushContext(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return c.Flush()
+}
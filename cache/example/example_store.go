@@ -23,23 +23,17 @@ func main() {
 		store := c.Get(cache.DefaultStoreContextKey).(*cache.GoCacheStore)
 		key := c.QueryString()
 
-		var cachedValue string
-		if err := store.Get(key, &cachedValue); err == nil && cachedValue != "" {
-			c.Response().Header().Set("From-Cache", "true")
-			c.Response().Header().Set("Cache-Control", "max-age=5")
-			return c.String(http.StatusOK, cachedValue)
-		} else {
-			c.Logger().Errorf("Enable to get value in cache %s\n", err)
-		}
-
-		// Awesome value
-		value := "pong"
-
-		err := store.Add(key, value, cache.DEFAULT)
+		// Concurrent requests of a missing key wait for the first one to compute it
+		var value string
+		err := cache.Fetch(store, key, cache.DEFAULT, func() (interface{}, error) {
+			// Awesome value
+			return "pong", nil
+		}, &value)
 		if err != nil {
-			c.Logger().Errorf("Enable to store value in cache %s\n", err)
+			return err
 		}
 
+		c.Response().Header().Set("Cache-Control", "max-age=5")
 		return c.String(http.StatusOK, value)
 	})
 
@@ -0,0 +1,183 @@
+package cache
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+)
+
+type (
+	//FetchConfig Struct for Configure Fetch
+	FetchConfig struct {
+		//Store defines which type of cache you use (Default: gocache).
+		Store Store
+
+		//Expire ttl of the values returned by the loader
+		Expire time.Duration
+
+		//ErrorExpire ttl of the errors returned by the loader, callers get the cached error instead of calling the
+		// loader until it expires. Errors are cached as their message under key + ":error" and returned as a
+		// *FetchError, 0 disables it (Default: 0).
+		ErrorExpire time.Duration
+	}
+
+	//FetchError error of a loader cached with FetchConfig.ErrorExpire. Only its message is stored, the caller gets
+	// a *FetchError instead of the error returned by the loader.
+	FetchError struct {
+		Key     string
+		Message string
+	}
+
+	// fetchCall loader call shared by the concurrent Fetch of a key
+	fetchCall struct {
+		wg    sync.WaitGroup
+		value interface{}
+		err   error
+	}
+
+	// fetchKey identifies a key of a Store by the type and the address of the Store, a Store may not be comparable
+	fetchKey struct {
+		storeType reflect.Type
+		store     uintptr
+		key       string
+	}
+)
+
+var (
+	//DefaultFetchConfig default config of Fetch
+	DefaultFetchConfig = FetchConfig{
+		Store:  defaultStore,
+		Expire: DEFAULT,
+	}
+
+	fetchMu    sync.Mutex
+	fetchCalls = map[fetchKey]*fetchCall{}
+)
+
+//Fetch gets the value of key in store, or calls loader and stores its result with expire on a miss or a store error
+// Concurrent Fetch of a key in this process share one loader call, value must be a pointer to the type returned by loader
+func Fetch(store Store, key string, expire time.Duration, loader func() (interface{}, error), value interface{}) error {
+	config := DefaultFetchConfig
+	config.Store = store
+	config.Expire = expire
+	return FetchWithConfig(config, key, loader, value)
+}
+
+//FetchWithConfig gets the value of key in config.Store, or calls loader and stores its result on a miss
+// Concurrent Fetch of a key in this process share one loader call, value must be a pointer to the type returned by loader.
+// The loader is also called if the store fails, so that the store being down doesn't fail the callers.
+// Only a Store held by a pointer shares loader calls.
+func FetchWithConfig(config FetchConfig, key string, loader func() (interface{}, error), value interface{}) error {
+	// Defaults
+	if config.Store == nil {
+		config.Store = DefaultFetchConfig.Store
+	}
+
+	if err := config.Store.Get(key, value); err == nil {
+		return nil
+	}
+
+	if config.ErrorExpire > 0 {
+		var message string
+		if err := config.Store.Get(fetchErrorKey(key), &message); err == nil {
+			return &FetchError{Key: key, Message: message}
+		}
+	}
+
+	call := load(config, key, loader)
+	if call.err != nil {
+		return call.err
+	}
+	return assign(value, call.value)
+}
+
+// load calls loader and stores its result, or waits for the result of the running call of key
+func load(config FetchConfig, key string, loader func() (interface{}, error)) *fetchCall {
+	store := reflect.ValueOf(config.Store)
+	if store.Kind() != reflect.Ptr {
+		call := &fetchCall{}
+		call.value, call.err = loader()
+		storeCall(config, key, call)
+		return call
+	}
+	id := fetchKey{store.Type(), store.Pointer(), key}
+
+	fetchMu.Lock()
+	if call, found := fetchCalls[id]; found {
+		fetchMu.Unlock()
+		call.wg.Wait()
+		return call
+	}
+	call := &fetchCall{}
+	call.wg.Add(1)
+	fetchCalls[id] = call
+	fetchMu.Unlock()
+
+	defer func() {
+		// The waiters get an error if loader panics, the panic goes on in this goroutine
+		r := recover()
+		if r != nil {
+			call.value, call.err = nil, fmt.Errorf("cache: loader of %s panicked: %v", key, r)
+		}
+
+		fetchMu.Lock()
+		delete(fetchCalls, id)
+		fetchMu.Unlock()
+		call.wg.Done()
+
+		if r != nil {
+			panic(r)
+		}
+	}()
+
+	call.value, call.err = loader()
+	storeCall(config, key, call)
+	return call
+}
+
+// storeCall stores the result of call, the loaded value is returned even if it can't be stored
+func storeCall(config FetchConfig, key string, call *fetchCall) {
+	if call.err == nil {
+		_ = config.Store.Set(key, call.value, config.Expire)
+	} else if config.ErrorExpire > 0 {
+		_ = config.Store.Set(fetchErrorKey(key), call.err.Error(), config.ErrorExpire)
+	}
+}
+
+func (e *FetchError) Error() string {
+	return e.Message
+}
+
+func fetchErrorKey(key string) string {
+	return key + ":error"
+}
+
+// assign sets the value pointed by ptrValue to value
+func assign(ptrValue interface{}, value interface{}) error {
+	v := reflect.ValueOf(ptrValue)
+	if v.Kind() != reflect.Ptr || !v.Elem().CanSet() {
+		return ErrNotStored
+	}
+
+	loaded := reflect.ValueOf(value)
+	if !loaded.IsValid() {
+		v.Elem().Set(reflect.Zero(v.Elem().Type()))
+		return nil
+	}
+	if !loaded.Type().AssignableTo(v.Elem().Type()) {
+		return &typeError{value: value, ptrValue: ptrValue}
+	}
+	v.Elem().Set(loaded)
+	return nil
+}
+
+// typeError value read from a Store which can't be assigned to the value of the caller
+type typeError struct {
+	value    interface{}
+	ptrValue interface{}
+}
+
+func (e *typeError) Error() string {
+	return fmt.Sprintf("cache: %T can't be assigned to %T", e.value, e.ptrValue)
+}
@@ -0,0 +1,156 @@
+package cache
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFetch(t *testing.T) {
+	store := NewGoCacheStore(time.Minute, time.Minute)
+	var loads int32
+	loader := func() (interface{}, error) {
+		atomic.AddInt32(&loads, 1)
+		return "value", nil
+	}
+
+	var value string
+	assert.NoError(t, Fetch(store, "key", DEFAULT, loader, &value))
+	assert.Equal(t, "value", value)
+
+	// Stored by the first Fetch
+	value = ""
+	assert.NoError(t, Fetch(store, "key", DEFAULT, loader, &value))
+	assert.Equal(t, "value", value)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&loads))
+
+	var stored string
+	assert.NoError(t, store.Get("key", &stored))
+	assert.Equal(t, "value", stored)
+
+	// Loaded type doesn't match
+	var number int
+	assert.Error(t, Fetch(store, "other", DEFAULT, loader, &number))
+}
+
+func TestFetch_SingleFlight(t *testing.T) {
+	store := NewGoCacheStore(time.Minute, time.Minute)
+	var loads int32
+	release := make(chan struct{})
+	loader := func() (interface{}, error) {
+		atomic.AddInt32(&loads, 1)
+		<-release
+		return 42, nil
+	}
+
+	var wg sync.WaitGroup
+	values := make([]int, 10)
+	for i := range values {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			assert.NoError(t, Fetch(store, "key", DEFAULT, loader, &values[i]))
+		}(i)
+	}
+
+	// Let every goroutine reach the loader call
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&loads))
+	for _, value := range values {
+		assert.Equal(t, 42, value)
+	}
+}
+
+func TestFetch_ErrorExpire(t *testing.T) {
+	store := NewGoCacheStore(time.Minute, time.Minute)
+	var loads int32
+	loader := func() (interface{}, error) {
+		atomic.AddInt32(&loads, 1)
+		return nil, errors.New("unavailable")
+	}
+
+	// Errors are not cached by default
+	var value string
+	assert.EqualError(t, Fetch(store, "key", DEFAULT, loader, &value), "unavailable")
+	assert.EqualError(t, Fetch(store, "key", DEFAULT, loader, &value), "unavailable")
+	assert.Equal(t, int32(2), atomic.LoadInt32(&loads))
+
+	config := FetchConfig{Store: store, Expire: DEFAULT, ErrorExpire: time.Second}
+	assert.EqualError(t, FetchWithConfig(config, "key", loader, &value), "unavailable")
+	err := FetchWithConfig(config, "key", loader, &value)
+	assert.Equal(t, &FetchError{Key: "key", Message: "unavailable"}, err)
+	assert.EqualError(t, err, "unavailable")
+	assert.Equal(t, int32(3), atomic.LoadInt32(&loads))
+
+	// Called again once the error expired
+	time.Sleep(1500 * time.Millisecond)
+	assert.EqualError(t, FetchWithConfig(config, "key", loader, &value), "unavailable")
+	assert.Equal(t, int32(4), atomic.LoadInt32(&loads))
+}
+
+// downStore Store failing every operation, not comparable
+type downStore struct {
+	Store
+	calls map[string]int
+}
+
+func (s downStore) Get(key string, _ interface{}) error {
+	s.calls["Get"]++
+	return errors.New("store down")
+}
+
+func (s downStore) Set(key string, _ interface{}, _ time.Duration) error {
+	s.calls["Set"]++
+	return errors.New("store down")
+}
+
+func TestFetch_StoreDown(t *testing.T) {
+	store := downStore{calls: map[string]int{}}
+	loader := func() (interface{}, error) {
+		return "value", nil
+	}
+
+	var value string
+	config := FetchConfig{Store: store, Expire: DEFAULT, ErrorExpire: time.Second}
+	assert.NoError(t, FetchWithConfig(config, "key", loader, &value))
+	assert.Equal(t, "value", value)
+	assert.Equal(t, map[string]int{"Get": 2, "Set": 1}, store.calls)
+}
+
+func TestFetch_LoaderPanic(t *testing.T) {
+	store := NewGoCacheStore(time.Minute, time.Minute)
+	loading := make(chan struct{})
+	release := make(chan struct{})
+	loader := func() (interface{}, error) {
+		close(loading)
+		<-release
+		panic("boom")
+	}
+
+	panicked := make(chan interface{})
+	go func() {
+		defer func() { panicked <- recover() }()
+		var value string
+		_ = Fetch(store, "key", DEFAULT, loader, &value)
+	}()
+
+	<-loading
+	waited := make(chan error)
+	go func() {
+		var value string
+		waited <- Fetch(store, "key", DEFAULT, func() (interface{}, error) { return "other", nil }, &value)
+	}()
+
+	// Let the waiter join the running call
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	assert.Equal(t, "boom", <-panicked)
+	assert.EqualError(t, <-waited, "cache: loader of key panicked: boom")
+}
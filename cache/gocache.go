@@ -1,18 +1,77 @@
 package cache
 
 import (
+	"fmt"
 	"reflect"
+	"strings"
+	"sync"
 	"time"
 
-	"github.com/robfig/go-cache"
+	"github.com/patrickmn/go-cache"
 )
 
+//GoCacheStore in-memory Store built on patrickmn/go-cache, Cache exposes the underlying cache
 type GoCacheStore struct {
-	cache.Cache
+	*cache.Cache
+
+	// mu serializes writes with compare-and-swap
+	mu sync.Mutex
+	// versions of the keys returned by Gets
+	versions *goCacheVersions
+}
+
+// goCacheVersions CAS versions of a GoCacheStore, a write or the eviction of its item deletes the version of a key.
+// It has its own lock as OnEvicted of go-cache is called within Delete, and doesn't reference the store so that the
+// janitor of go-cache still stops once the store is collected.
+type goCacheVersions struct {
+	sync.Mutex
+	versions map[string]uint64
+	last     uint64
 }
 
+//NewGoCacheStore create a GoCacheStore, the OnEvicted callback of its Cache is used to drop CAS versions
 func NewGoCacheStore(defaultExpiration time.Duration, cleanupInterval time.Duration) *GoCacheStore {
-	return &GoCacheStore{*cache.New(defaultExpiration, cleanupInterval)}
+	versions := &goCacheVersions{versions: map[string]uint64{}}
+	c := &GoCacheStore{Cache: cache.New(defaultExpiration, cleanupInterval), versions: versions}
+	c.Cache.OnEvicted(func(key string, _ interface{}) {
+		versions.drop(key)
+	})
+	return c
+}
+
+// get returns the version of key, a new one if it has none
+func (v *goCacheVersions) get(key string) uint64 {
+	v.Lock()
+	defer v.Unlock()
+
+	version, found := v.versions[key]
+	if !found {
+		v.last++
+		version = v.last
+		v.versions[key] = version
+	}
+	return version
+}
+
+// match returns true if version is the version of key
+func (v *goCacheVersions) match(key string, version interface{}) bool {
+	v.Lock()
+	defer v.Unlock()
+
+	current, found := v.versions[key]
+	return found && current == version
+}
+
+func (v *goCacheVersions) drop(key string) {
+	v.Lock()
+	defer v.Unlock()
+	delete(v.versions, key)
+}
+
+func (v *goCacheVersions) reset() {
+	v.Lock()
+	defer v.Unlock()
+	v.versions = map[string]uint64{}
 }
 
 func (c *GoCacheStore) Get(key string, value interface{}) error {
@@ -20,30 +79,35 @@ func (c *GoCacheStore) Get(key string, value interface{}) error {
 	if !found {
 		return ErrCacheMiss
 	}
-
-	v := reflect.ValueOf(value)
-	if v.Type().Kind() == reflect.Ptr && v.Elem().CanSet() {
-		v.Elem().Set(reflect.ValueOf(val))
-		return nil
-	}
-	return ErrNotStored
+	return assign(value, val)
 }
 
 func (c *GoCacheStore) Set(key string, value interface{}, expires time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.versions.drop(key)
+
 	// NOTE: go-cache understands the values of DEFAULT and FOREVER
 	c.Cache.Set(key, value, expires)
 	return nil
 }
 
 func (c *GoCacheStore) Add(key string, value interface{}, expires time.Duration) error {
-	err := c.Cache.Add(key, value, expires)
-	if err == cache.ErrKeyExists {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.versions.drop(key)
+
+	if err := c.Cache.Add(key, value, expires); err != nil {
 		return ErrNotStored
 	}
-	return err
+	return nil
 }
 
 func (c *GoCacheStore) Replace(key string, value interface{}, expires time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.versions.drop(key)
+
 	if err := c.Cache.Replace(key, value, expires); err != nil {
 		return ErrNotStored
 	}
@@ -51,29 +115,179 @@ func (c *GoCacheStore) Replace(key string, value interface{}, expires time.Durat
 }
 
 func (c *GoCacheStore) Delete(key string) error {
-	if found := c.Cache.Delete(key); !found {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.versions.drop(key)
+
+	if _, found := c.Cache.Get(key); !found {
 		return ErrCacheMiss
 	}
+	c.Cache.Delete(key)
 	return nil
 }
 
+// Increment wraps around like an unsigned integer of the type of the value
 func (c *GoCacheStore) Increment(key string, n uint64) (uint64, error) {
-	newValue, err := c.Cache.Increment(key, n)
-	if err == cache.ErrCacheMiss {
-		return 0, ErrCacheMiss
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.versions.drop(key)
+
+	if _, err := c.uint64(key); err != nil {
+		return 0, err
 	}
-	return newValue, err
+	if err := c.Cache.Increment(key, int64(n)); err != nil {
+		return 0, err
+	}
+	return c.uint64(key)
 }
 
+// Decrement stops at 0
 func (c *GoCacheStore) Decrement(key string, n uint64) (uint64, error) {
-	newValue, err := c.Cache.Decrement(key, n)
-	if err == cache.ErrCacheMiss {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.versions.drop(key)
+
+	current, err := c.uint64(key)
+	if err != nil {
+		return 0, err
+	}
+	if n > current {
+		n = current
+	}
+	if err := c.Cache.Decrement(key, int64(n)); err != nil {
+		return 0, err
+	}
+	return current - n, nil
+}
+
+// uint64 returns the integer value of key
+func (c *GoCacheStore) uint64(key string) (uint64, error) {
+	value, found := c.Cache.Get(key)
+	if !found {
 		return 0, ErrCacheMiss
 	}
-	return newValue, err
+
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return uint64(v.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint(), nil
+	}
+	return 0, fmt.Errorf("the value for %s is not an integer", key)
 }
 
 func (c *GoCacheStore) Flush() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// go-cache doesn't call OnEvicted on Flush
+	c.versions.reset()
+
 	c.Cache.Flush()
 	return nil
 }
+
+func (c *GoCacheStore) GetMulti(values map[string]interface{}) error {
+	for key, value := range values {
+		if err := c.Get(key, value); err == ErrCacheMiss {
+			delete(values, key)
+		} else if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *GoCacheStore) SetMulti(values map[string]interface{}, expires time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key, value := range values {
+		c.versions.drop(key)
+		c.Cache.Set(key, value, expires)
+	}
+	return nil
+}
+
+func (c *GoCacheStore) DeleteMulti(keys ...string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, key := range keys {
+		c.versions.drop(key)
+		c.Cache.Delete(key)
+	}
+	return nil
+}
+
+// Gets versions are only kept for keys read with Gets until their next write or the eviction of their item by the
+// janitor of go-cache
+func (c *GoCacheStore) Gets(key string, value interface{}) (CASToken, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.Get(key, value); err != nil {
+		return CASToken{}, err
+	}
+
+	version := c.versions.get(key)
+	// The item may have been evicted before its version was stored
+	if _, found := c.Cache.Get(key); !found {
+		c.versions.drop(key)
+		return CASToken{}, ErrCacheMiss
+	}
+	return CASToken{version}, nil
+}
+
+func (c *GoCacheStore) CompareAndSwap(key string, value interface{}, token CASToken, expires time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, found := c.Cache.Get(key); !found {
+		c.versions.drop(key)
+		return ErrCacheMiss
+	}
+	if !c.versions.match(key, token.version) {
+		return ErrCASConflict
+	}
+
+	c.versions.drop(key)
+	c.Cache.Set(key, value, expires)
+	return nil
+}
+
+//TTL returns the remaining ttl of key from its go-cache expiration
+func (c *GoCacheStore) TTL(key string) (time.Duration, error) {
+	_, expiration, found := c.Cache.GetWithExpiration(key)
+	if !found {
+		return 0, ErrCacheMiss
+	}
+	if expiration.IsZero() {
+		return NEVER, nil
+	}
+	return time.Until(expiration), nil
+}
+
+//Touch stores the value of key again with the new ttl, its CAS version is kept
+func (c *GoCacheStore) Touch(key string, expires time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	value, found := c.Cache.Get(key)
+	if !found {
+		return ErrCacheMiss
+	}
+	c.Cache.Set(key, value, expires)
+	return nil
+}
+
+//Scan calls fn for every unexpired key starting with prefix, on a copy of the items taken before the first call
+func (c *GoCacheStore) Scan(prefix string, fn func(key string) bool) error {
+	for key := range c.Cache.Items() {
+		if strings.HasPrefix(key, prefix) && !fn(key) {
+			return nil
+		}
+	}
+	return nil
+}
@@ -3,6 +3,8 @@ package cache
 import (
 	"testing"
 	"time"
+
+	"github.com/stretchr/testify/assert"
 )
 
 var newGoCacheStore = func(_ *testing.T, defaultExpiration time.Duration) Store {
@@ -21,6 +23,10 @@ func TestGoCacheCache_Expiration(t *testing.T) {
 	expiration(t, newGoCacheStore)
 }
 
+func TestGoCacheCache_MillisecondExpiration(t *testing.T) {
+	millisecondExpiration(t, newGoCacheStore)
+}
+
 func TestGoCacheCache_EmptyCache(t *testing.T) {
 	emptyCache(t, newGoCacheStore)
 }
@@ -32,3 +38,46 @@ func TestGoCacheCache_Replace(t *testing.T) {
 func TestGoCacheCache_Add(t *testing.T) {
 	testAdd(t, newGoCacheStore)
 }
+
+func TestGoCacheCache_NamespaceFlush(t *testing.T) {
+	testNamespaceFlush(t, newGoCacheStore)
+}
+
+func TestGoCacheCache_Batch(t *testing.T) {
+	testBatch(t, newGoCacheStore)
+}
+
+func TestGoCacheCache_CompareAndSwap(t *testing.T) {
+	testCAS(t, newGoCacheStore)
+}
+
+func TestGoCacheCache_TTL(t *testing.T) {
+	testTTL(t, newGoCacheStore)
+}
+
+func TestGoCacheCache_Context(t *testing.T) {
+	testContext(t, newGoCacheStore)
+}
+
+func TestGoCacheCache_Scan(t *testing.T) {
+	testScan(t, newGoCacheStore)
+}
+
+func TestGoCacheStore_EvictedVersions(t *testing.T) {
+	store := NewGoCacheStore(time.Hour, 5*time.Millisecond)
+
+	var value string
+	assert.NoError(t, store.Set("expired", "value", 10*time.Millisecond))
+	_, err := store.Gets("expired", &value)
+	assert.NoError(t, err)
+	assert.NoError(t, store.Set("deleted", "value", DEFAULT))
+	_, err = store.Gets("deleted", &value)
+	assert.NoError(t, err)
+
+	store.Cache.Delete("deleted")
+	time.Sleep(50 * time.Millisecond)
+
+	store.versions.Lock()
+	defer store.versions.Unlock()
+	assert.Empty(t, store.versions.versions)
+}
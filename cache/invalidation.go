@@ -0,0 +1,342 @@
+package cache
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+//InvalidationOp kind of Invalidation
+type InvalidationOp string
+
+const (
+	//InvalidateKey deletes Invalidation.Key
+	InvalidateKey InvalidationOp = "key"
+	//InvalidatePrefix deletes the keys starting with Invalidation.Key, the local Store must implement ScanStore
+	InvalidatePrefix InvalidationOp = "prefix"
+	//InvalidateFlush flushes the Store
+	InvalidateFlush InvalidationOp = "flush"
+)
+
+type (
+	//Invalidation message broadcast by an InvalidationBus
+	Invalidation struct {
+		//Source id of the InvalidatingStore which published it, a store ignores its own invalidations
+		Source string         `json:"source"`
+		Op     InvalidationOp `json:"op"`
+		//Key key or prefix to delete
+		Key string `json:"key,omitempty"`
+	}
+
+	//InvalidationBus broadcasts invalidations to every InvalidatingStore of every instance
+	InvalidationBus interface {
+		//Publish sends invalidation to every subscriber, including the ones of this instance
+		Publish(invalidation Invalidation) error
+		//Subscribe calls fn for every invalidation published until unsubscribe is called
+		Subscribe(fn func(Invalidation)) (unsubscribe func(), err error)
+	}
+
+	//LocalInvalidationBus InvalidationBus of a single process, Publish calls the subscribers synchronously
+	LocalInvalidationBus struct {
+		subscribers
+	}
+
+	//RedisInvalidationBus InvalidationBus over a redis pub/sub channel. Invalidations published while the
+	// subscription is broken are lost, subscribers get an InvalidateFlush once it is restored.
+	RedisInvalidationBus struct {
+		subscribers
+
+		pool    *redis.Pool
+		channel string
+
+		// mu guards conn, done and closed. Only the receiving goroutine uses conn, Close just closes it to
+		// unblock the goroutine and waits for done.
+		mu     sync.Mutex
+		conn   *redis.PubSubConn
+		done   chan struct{}
+		closed bool
+	}
+
+	//InvalidatingStore Wraps the local Store of an instance (GoCacheStore, ...) to keep it in sync with the others:
+	// writes, deletes and flushes are published on an InvalidationBus and the ones of other instances delete the
+	// keys from the local Store. Don't wrap a Store shared between instances, it would delete the new values.
+	InvalidatingStore struct {
+		store Store
+		bus   InvalidationBus
+		id    string
+
+		unsubscribe func()
+	}
+
+	// subscribers callbacks of an InvalidationBus
+	subscribers struct {
+		mu        sync.RWMutex
+		callbacks map[int]func(Invalidation)
+		next      int
+	}
+)
+
+// redisResubscribeDelay delay before restoring a broken subscription
+const redisResubscribeDelay = time.Second
+
+//NewLocalInvalidationBus create an InvalidationBus for the stores of this process, useful in tests
+func NewLocalInvalidationBus() *LocalInvalidationBus {
+	return &LocalInvalidationBus{}
+}
+
+func (b *LocalInvalidationBus) Publish(invalidation Invalidation) error {
+	b.notify(invalidation)
+	return nil
+}
+
+func (b *LocalInvalidationBus) Subscribe(fn func(Invalidation)) (func(), error) {
+	return b.add(fn), nil
+}
+
+//NewRedisInvalidationBus create an InvalidationBus publishing on channel with the connections of store
+func NewRedisInvalidationBus(store *RedisStore, channel string) *RedisInvalidationBus {
+	return &RedisInvalidationBus{pool: store.pool, channel: channel}
+}
+
+func (b *RedisInvalidationBus) Publish(invalidation Invalidation) error {
+	data, err := json.Marshal(invalidation)
+	if err != nil {
+		return err
+	}
+
+	conn := b.pool.Get()
+	defer conn.Close()
+	_, err = conn.Do("PUBLISH", b.channel, data)
+	return err
+}
+
+//Subscribe the first subscription starts the goroutine receiving the invalidations
+func (b *RedisInvalidationBus) Subscribe(fn func(Invalidation)) (func(), error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return nil, ErrClosed
+	}
+
+	if b.conn == nil {
+		conn, err := b.subscribe()
+		if err != nil {
+			return nil, err
+		}
+		b.conn, b.done = conn, make(chan struct{})
+		go b.receive(conn, b.done)
+	}
+	return b.add(fn), nil
+}
+
+//Close stops receiving invalidations and waits for the receiving goroutine to exit
+func (b *RedisInvalidationBus) Close() error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return nil
+	}
+	b.closed = true
+	conn, done := b.conn, b.done
+	b.mu.Unlock()
+
+	if conn == nil {
+		return nil
+	}
+	// Unblocks Receive, the goroutine exits as the bus is closed
+	_ = conn.Close()
+	<-done
+	return nil
+}
+
+// subscribe dials a connection of its own, closing a connection of the pool would unsubscribe on it
+func (b *RedisInvalidationBus) subscribe() (*redis.PubSubConn, error) {
+	c, err := b.pool.Dial()
+	if err != nil {
+		return nil, err
+	}
+	conn := &redis.PubSubConn{Conn: c}
+	if err := conn.Subscribe(b.channel); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// receive notifies the subscribers until the bus is closed, restoring the subscription when it breaks. done is
+// closed once it returns.
+func (b *RedisInvalidationBus) receive(conn *redis.PubSubConn, done chan struct{}) {
+	defer close(done)
+
+	for {
+		switch message := conn.Receive().(type) {
+		case redis.Message:
+			var invalidation Invalidation
+			if err := json.Unmarshal(message.Data, &invalidation); err == nil {
+				b.notify(invalidation)
+			}
+		case error:
+			// Also returned once Close closed conn
+			_ = conn.Close()
+			if conn = b.resubscribe(); conn == nil {
+				return
+			}
+			// Invalidations may have been lost meanwhile
+			b.notify(Invalidation{Op: InvalidateFlush})
+		}
+	}
+}
+
+// resubscribe returns a new subscribed connection, nil once the bus is closed
+func (b *RedisInvalidationBus) resubscribe() *redis.PubSubConn {
+	for {
+		b.mu.Lock()
+		if b.closed {
+			b.mu.Unlock()
+			return nil
+		}
+		conn, err := b.subscribe()
+		if err == nil {
+			b.conn = conn
+			b.mu.Unlock()
+			return conn
+		}
+		b.mu.Unlock()
+		time.Sleep(redisResubscribeDelay)
+	}
+}
+
+// add registers fn and returns the func removing it
+func (s *subscribers) add(fn func(Invalidation)) func() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.callbacks == nil {
+		s.callbacks = map[int]func(Invalidation){}
+	}
+	id := s.next
+	s.next++
+	s.callbacks[id] = fn
+
+	return func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		delete(s.callbacks, id)
+	}
+}
+
+// notify calls the callbacks without holding the lock, a callback may unsubscribe
+func (s *subscribers) notify(invalidation Invalidation) {
+	s.mu.RLock()
+	callbacks := make([]func(Invalidation), 0, len(s.callbacks))
+	for _, fn := range s.callbacks {
+		callbacks = append(callbacks, fn)
+	}
+	s.mu.RUnlock()
+
+	for _, fn := range callbacks {
+		fn(invalidation)
+	}
+}
+
+//NewInvalidatingStore create an InvalidatingStore subscribed to bus, call Close to unsubscribe
+func NewInvalidatingStore(store Store, bus InvalidationBus) (*InvalidatingStore, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+
+	c := &InvalidatingStore{store: store, bus: bus, id: hex.EncodeToString(id)}
+	unsubscribe, err := bus.Subscribe(c.apply)
+	if err != nil {
+		return nil, err
+	}
+	c.unsubscribe = unsubscribe
+	return c, nil
+}
+
+// apply applies the invalidations of the other stores to the local Store
+func (c *InvalidatingStore) apply(invalidation Invalidation) {
+	if invalidation.Source == c.id {
+		return
+	}
+
+	switch invalidation.Op {
+	case InvalidateKey:
+		_ = c.store.Delete(invalidation.Key)
+	case InvalidatePrefix:
+		_, _ = PurgePrefix(c.store, invalidation.Key)
+	case InvalidateFlush:
+		_ = c.store.Flush()
+	}
+}
+
+// publish invalidates key on the other instances once the local operation succeeded
+func (c *InvalidatingStore) publish(op InvalidationOp, key string, err error) error {
+	if err != nil {
+		return err
+	}
+	return c.bus.Publish(Invalidation{Source: c.id, Op: op, Key: key})
+}
+
+//Close unsubscribes the store from the bus
+func (c *InvalidatingStore) Close() error {
+	c.unsubscribe()
+	return nil
+}
+
+func (c *InvalidatingStore) Get(key string, value interface{}) error {
+	return c.store.Get(key, value)
+}
+
+func (c *InvalidatingStore) Set(key string, value interface{}, expire time.Duration) error {
+	return c.publish(InvalidateKey, key, c.store.Set(key, value, expire))
+}
+
+func (c *InvalidatingStore) Add(key string, value interface{}, expire time.Duration) error {
+	return c.publish(InvalidateKey, key, c.store.Add(key, value, expire))
+}
+
+func (c *InvalidatingStore) Replace(key string, value interface{}, expire time.Duration) error {
+	return c.publish(InvalidateKey, key, c.store.Replace(key, value, expire))
+}
+
+//Delete the key is invalidated on the other instances even if it isn't in the local Store
+func (c *InvalidatingStore) Delete(key string) error {
+	err := c.store.Delete(key)
+	if err != nil && err != ErrCacheMiss {
+		return err
+	}
+	if err := c.publish(InvalidateKey, key, nil); err != nil {
+		return err
+	}
+	return err
+}
+
+func (c *InvalidatingStore) Increment(key string, delta uint64) (uint64, error) {
+	newValue, err := c.store.Increment(key, delta)
+	return newValue, c.publish(InvalidateKey, key, err)
+}
+
+func (c *InvalidatingStore) Decrement(key string, delta uint64) (uint64, error) {
+	newValue, err := c.store.Decrement(key, delta)
+	return newValue, c.publish(InvalidateKey, key, err)
+}
+
+func (c *InvalidatingStore) Flush() error {
+	return c.publish(InvalidateFlush, "", c.store.Flush())
+}
+
+//Scan the local Store must implement ScanStore
+func (c *InvalidatingStore) Scan(prefix string, fn func(key string) bool) error {
+	return Scan(c.store, prefix, fn)
+}
+
+//PurgePrefix deletes the keys starting with prefix from the local Store and invalidates them on the other instances
+func (c *InvalidatingStore) PurgePrefix(prefix string) (int, error) {
+	purged, err := PurgePrefix(c.store, prefix)
+	return purged, c.publish(InvalidatePrefix, prefix, err)
+}
@@ -0,0 +1,102 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newInvalidatingStores(t *testing.T, bus InvalidationBus) (*GoCacheStore, *InvalidatingStore, *GoCacheStore, *InvalidatingStore) {
+	localA, localB := NewGoCacheStore(time.Hour, time.Minute), NewGoCacheStore(time.Hour, time.Minute)
+	a, err := NewInvalidatingStore(localA, bus)
+	assert.NoError(t, err)
+	b, err := NewInvalidatingStore(localB, bus)
+	assert.NoError(t, err)
+	return localA, a, localB, b
+}
+
+func TestInvalidatingStore(t *testing.T) {
+	localA, a, localB, b := newInvalidatingStores(t, NewLocalInvalidationBus())
+	var get int
+
+	// Write invalidates the other instance only
+	assert.NoError(t, localB.Set("int", 1, DEFAULT))
+	assert.NoError(t, a.Set("int", 2, DEFAULT))
+	assert.Equal(t, ErrCacheMiss, localB.Get("int", &get))
+	assert.NoError(t, localA.Get("int", &get))
+	assert.Equal(t, 2, get)
+
+	// Delete is published even if the key isn't stored locally
+	assert.NoError(t, localA.Set("int", 3, DEFAULT))
+	assert.Equal(t, ErrCacheMiss, b.Delete("int"))
+	assert.Equal(t, ErrCacheMiss, localA.Get("int", &get))
+
+	// Prefix
+	assert.NoError(t, localB.Set("prefix:a", 1, DEFAULT))
+	assert.NoError(t, localB.Set("other", 1, DEFAULT))
+	assert.NoError(t, localA.Set("prefix:b", 1, DEFAULT))
+	purged, err := a.PurgePrefix("prefix:")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, purged)
+	assert.Equal(t, ErrCacheMiss, localB.Get("prefix:a", &get))
+	assert.NoError(t, localB.Get("other", &get))
+
+	// Flush
+	assert.NoError(t, a.Flush())
+	assert.Equal(t, ErrCacheMiss, localB.Get("other", &get))
+
+	// Closed store isn't invalidated anymore
+	assert.NoError(t, b.Close())
+	assert.NoError(t, localB.Set("int", 4, DEFAULT))
+	assert.NoError(t, a.Set("int", 5, DEFAULT))
+	assert.NoError(t, localB.Get("int", &get))
+	assert.Equal(t, 4, get)
+}
+
+func TestRedisInvalidationBus(t *testing.T) {
+	redisStore := newRedisStore(t, time.Hour).(*RedisStore)
+	busA := NewRedisInvalidationBus(redisStore, "test:invalidation")
+	busB := NewRedisInvalidationBus(redisStore, "test:invalidation")
+	defer busA.Close()
+	defer busB.Close()
+
+	localA := NewGoCacheStore(time.Hour, time.Minute)
+	a, err := NewInvalidatingStore(localA, busA)
+	assert.NoError(t, err)
+	localB := NewGoCacheStore(time.Hour, time.Minute)
+	_, err = NewInvalidatingStore(localB, busB)
+	assert.NoError(t, err)
+
+	var get int
+	assert.NoError(t, localB.Set("int", 1, DEFAULT))
+	assert.NoError(t, a.Set("int", 2, DEFAULT))
+
+	// Delivered asynchronously
+	deadline := time.Now().Add(2 * time.Second)
+	for localB.Get("int", &get) == nil && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, ErrCacheMiss, localB.Get("int", &get))
+	assert.NoError(t, localA.Get("int", &get))
+	assert.Equal(t, 2, get)
+
+	assert.NoError(t, busB.Close())
+	_, err = busB.Subscribe(func(Invalidation) {})
+	assert.Equal(t, ErrClosed, err)
+}
+
+func TestLocalInvalidationBus_UnsubscribeInCallback(t *testing.T) {
+	bus := NewLocalInvalidationBus()
+	calls := 0
+	var unsubscribe func()
+	unsubscribe, err := bus.Subscribe(func(Invalidation) {
+		calls++
+		unsubscribe()
+	})
+	assert.NoError(t, err)
+
+	assert.NoError(t, bus.Publish(Invalidation{Op: InvalidateFlush}))
+	assert.NoError(t, bus.Publish(Invalidation{Op: InvalidateFlush}))
+	assert.Equal(t, 1, calls)
+}
@@ -1,77 +1,490 @@
 package cache
 
 import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/bradfitz/gomemcache/memcache"
 )
 
+//MemcachedOptions Struct for Configure MemcachedStore
+type MemcachedOptions struct {
+	//Hosts addresses of the memcached servers
+	Hosts []string
+
+	//Ketama spreads the keys over Hosts with a KetamaSelector instead of the modulo of gomemcache, adding or removing a
+	// host then only remaps its keys (Default: false)
+	Ketama bool
+
+	//Weights weight of the hosts with Ketama, a host gets a share of the keys proportional to its weight. Hosts
+	// missing from Weights have a weight of 1 (Default: nil).
+	Weights map[string]int
+
+	//Timeout timeout for dialing a server, reading a reply and writing a command (Default: 100ms)
+	Timeout time.Duration
+
+	//MaxIdleConns max number of idle connections kept by server (Default: 2)
+	MaxIdleConns int
+
+	//DefaultExpiration ttl used when storing a value with DEFAULT
+	DefaultExpiration time.Duration
+
+	//KeyIndex keeps in memory the keys stored by this MemcachedStore so Scan can list them, memcached can't. Keys
+	// stored by other processes are not listed (Default: false).
+	KeyIndex bool
+
+	//FlushDelay Flush sends flush_all with this delay, rounded up to the second, items are invalidated once it is
+	// elapsed (Default: 0, at once)
+	FlushDelay time.Duration
+
+	//Namespace prefixes every key with Namespace and a version kept in memcached, Flush then increments the version
+	// instead of sending flush_all so that it only invalidates the keys of this store. Keys of previous versions
+	// are left to expire (Default: "", Flush sends flush_all to every server).
+	Namespace string
+}
+
 type MemcachedStore struct {
 	*memcache.Client
+	servers           memcache.ServerSelector
 	defaultExpiration time.Duration
+	flushDelay        time.Duration
+
+	// index nil without MemcachedOptions.KeyIndex
+	index *keyIndex
+	// namespace nil without MemcachedOptions.Namespace, keeps the version mixed into the keys
+	namespace *NamespaceStore
+}
+
+// keyIndex set of the keys stored by a MemcachedStore, they may have expired or been evicted since
+type keyIndex struct {
+	mu   sync.Mutex
+	keys map[string]struct{}
 }
 
 func NewMemcachedStore(hostList []string, defaultExpiration time.Duration) *MemcachedStore {
-	return &MemcachedStore{memcache.New(hostList...), defaultExpiration}
+	return NewMemcachedStoreWithOptions(MemcachedOptions{
+		Hosts:             hostList,
+		DefaultExpiration: defaultExpiration,
+	})
+}
+
+//NewMemcachedStoreWithOptions create a MemcachedStore configured with options
+func NewMemcachedStoreWithOptions(options MemcachedOptions) *MemcachedStore {
+	// Defaults
+	if options.Timeout <= 0 {
+		options.Timeout = memcache.DefaultTimeout
+	}
+	if options.MaxIdleConns <= 0 {
+		options.MaxIdleConns = memcache.DefaultMaxIdleConns
+	}
+
+	// The servers are kept for Flush
+	servers := newMemcachedServers(options.Hosts, options.Ketama, options.Weights)
+	client := memcache.NewFromSelector(servers)
+	client.Timeout, client.MaxIdleConns = options.Timeout, options.MaxIdleConns
+
+	store := &MemcachedStore{
+		Client:            client,
+		servers:           servers,
+		defaultExpiration: options.DefaultExpiration,
+		flushDelay:        options.FlushDelay,
+	}
+	if options.KeyIndex {
+		store.index = &keyIndex{keys: map[string]struct{}{}}
+	}
+	if options.Namespace != "" {
+		// The version is stored without namespace
+		store.namespace = NewNamespaceStore(&MemcachedStore{Client: store.Client, defaultExpiration: store.defaultExpiration}, options.Namespace)
+	}
+	return store
+}
+
+// newMemcachedServers returns a KetamaSelector of hosts if ketama is set, a memcache.ServerList otherwise. Like
+// memcache.New, there are no servers if an address doesn't resolve.
+func newMemcachedServers(hosts []string, ketama bool, weights map[string]int) memcache.ServerSelector {
+	if ketama {
+		hostWeights := make(map[string]int, len(hosts))
+		for _, host := range hosts {
+			hostWeights[host] = weights[host]
+		}
+		selector := NewKetamaSelector()
+		_ = selector.SetServers(hostWeights)
+		return selector
+	}
+
+	list := new(memcache.ServerList)
+	_ = list.SetServers(hosts...)
+	return list
+}
+
+// key returns the key of memcached, prefixed with the namespace and its version if any
+func (c *MemcachedStore) key(key string) (string, error) {
+	if c.namespace == nil {
+		return key, nil
+	}
+	return c.namespace.key(key)
 }
 
 func (c *MemcachedStore) Set(key string, value interface{}, expires time.Duration) error {
-	return c.invoke((*memcache.Client).Set, key, value, expires)
+	return c.SetContext(context.Background(), key, value, expires)
+}
+
+func (c *MemcachedStore) SetContext(ctx context.Context, key string, value interface{}, expires time.Duration) error {
+	return c.invoke(ctx, (*memcache.Client).Set, key, value, expires)
 }
 
 func (c *MemcachedStore) Add(key string, value interface{}, expires time.Duration) error {
-	return c.invoke((*memcache.Client).Add, key, value, expires)
+	return c.AddContext(context.Background(), key, value, expires)
+}
+
+func (c *MemcachedStore) AddContext(ctx context.Context, key string, value interface{}, expires time.Duration) error {
+	return c.invoke(ctx, (*memcache.Client).Add, key, value, expires)
 }
 
 func (c *MemcachedStore) Replace(key string, value interface{}, expires time.Duration) error {
-	return c.invoke((*memcache.Client).Replace, key, value, expires)
+	return c.ReplaceContext(context.Background(), key, value, expires)
+}
+
+func (c *MemcachedStore) ReplaceContext(ctx context.Context, key string, value interface{}, expires time.Duration) error {
+	return c.invoke(ctx, (*memcache.Client).Replace, key, value, expires)
 }
 
 func (c *MemcachedStore) Get(key string, value interface{}) error {
-	item, err := c.Client.Get(key)
+	return c.GetContext(context.Background(), key, value)
+}
+
+func (c *MemcachedStore) GetContext(ctx context.Context, key string, value interface{}) error {
+	key, err := c.key(key)
+	if err != nil {
+		return err
+	}
+	var item *memcache.Item
+	err = c.run(ctx, func() (err error) {
+		item, err = c.Client.Get(key)
+		return err
+	})
 	if err != nil {
 		return convertMemcacheError(err)
 	}
 	return deserialize(item.Value, value)
 }
 
+func (c *MemcachedStore) Gets(key string, value interface{}) (CASToken, error) {
+	key, err := c.key(key)
+	if err != nil {
+		return CASToken{}, err
+	}
+	item, err := c.Client.Get(key)
+	if err != nil {
+		return CASToken{}, convertMemcacheError(err)
+	}
+	return CASToken{item}, deserialize(item.Value, value)
+}
+
+func (c *MemcachedStore) CompareAndSwap(key string, value interface{}, token CASToken, expire time.Duration) error {
+	item, ok := token.version.(*memcache.Item)
+	if !ok {
+		return ErrCASConflict
+	}
+	if memcachedKey, err := c.key(key); err != nil {
+		return err
+	} else if item.Key != memcachedKey {
+		return ErrCASConflict
+	}
+
+	return c.invoke(context.Background(), func(client *memcache.Client, newItem *memcache.Item) error {
+		// Item returned by Get holds the cas unique id
+		item.Value, item.Expiration = newItem.Value, newItem.Expiration
+		return client.CompareAndSwap(item)
+	}, key, value, expire)
+}
+
 func (c *MemcachedStore) Delete(key string) error {
-	return convertMemcacheError(c.Client.Delete(key))
+	return c.DeleteContext(context.Background(), key)
+}
+
+func (c *MemcachedStore) DeleteContext(ctx context.Context, key string) error {
+	memcachedKey, err := c.key(key)
+	if err != nil {
+		return err
+	}
+	err = convertMemcacheError(c.run(ctx, func() error {
+		return c.Client.Delete(memcachedKey)
+	}))
+	if err == nil || err == ErrCacheMiss {
+		c.index.remove(key)
+	}
+	return err
 }
 
 func (c *MemcachedStore) Increment(key string, delta uint64) (uint64, error) {
-	newValue, err := c.Client.Increment(key, delta)
-	return newValue, convertMemcacheError(err)
+	return c.IncrementContext(context.Background(), key, delta)
+}
+
+func (c *MemcachedStore) IncrementContext(ctx context.Context, key string, delta uint64) (uint64, error) {
+	key, err := c.key(key)
+	if err != nil {
+		return 0, err
+	}
+	var newValue uint64
+	err = c.run(ctx, func() (err error) {
+		newValue, err = c.Client.Increment(key, delta)
+		return err
+	})
+	if err != nil {
+		return 0, convertMemcacheError(err)
+	}
+	return newValue, nil
 }
 
 func (c *MemcachedStore) Decrement(key string, delta uint64) (uint64, error) {
-	newValue, err := c.Client.Decrement(key, delta)
-	return newValue, convertMemcacheError(err)
+	return c.DecrementContext(context.Background(), key, delta)
+}
+
+func (c *MemcachedStore) DecrementContext(ctx context.Context, key string, delta uint64) (uint64, error) {
+	key, err := c.key(key)
+	if err != nil {
+		return 0, err
+	}
+	var newValue uint64
+	err = c.run(ctx, func() (err error) {
+		newValue, err = c.Client.Decrement(key, delta)
+		return err
+	})
+	if err != nil {
+		return 0, convertMemcacheError(err)
+	}
+	return newValue, nil
+}
+
+func (c *MemcachedStore) GetMulti(values map[string]interface{}) error {
+	keys := make([]string, 0, len(values))
+	memcachedKeys := make(map[string]string, len(values))
+	for key := range values {
+		memcachedKey, err := c.key(key)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, memcachedKey)
+		memcachedKeys[key] = memcachedKey
+	}
+
+	items, err := c.Client.GetMulti(keys)
+	if err != nil {
+		return convertMemcacheError(err)
+	}
+
+	for key, value := range values {
+		item, found := items[memcachedKeys[key]]
+		if !found {
+			delete(values, key)
+			continue
+		}
+		if err := deserialize(item.Value, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetMulti memcached protocol has no multi set, values are stored one by one
+func (c *MemcachedStore) SetMulti(values map[string]interface{}, expires time.Duration) error {
+	for key, value := range values {
+		if err := c.Set(key, value, expires); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteMulti memcached protocol has no multi delete, keys are deleted one by one
+func (c *MemcachedStore) DeleteMulti(keys ...string) error {
+	for _, key := range keys {
+		if err := c.Delete(key); err != nil && err != ErrCacheMiss {
+			return err
+		}
+	}
+	return nil
+}
+
+// TTL memcached protocol doesn't expose the expiration of an item
+func (c *MemcachedStore) TTL(key string) (time.Duration, error) {
+	return 0, ErrNotSupport
+}
+
+func (c *MemcachedStore) Touch(key string, expires time.Duration) error {
+	key, err := c.key(key)
+	if err != nil {
+		return err
+	}
+	return convertMemcacheError(c.Client.Touch(key, c.expiration(expires)))
+}
+
+//Scan calls fn for every stored key starting with prefix, it requires MemcachedOptions.KeyIndex. Keys of the index
+// are checked by batch of 100 with GetMulti, missing keys are removed from the index.
+func (c *MemcachedStore) Scan(prefix string, fn func(key string) bool) error {
+	if c.index == nil {
+		return ErrNotSupport
+	}
+
+	namespacePrefix, err := c.key("")
+	if err != nil {
+		return err
+	}
+
+	keys := c.index.scan(prefix)
+	for start := 0; start < len(keys); start += 100 {
+		end := start + 100
+		if end > len(keys) {
+			end = len(keys)
+		}
+
+		memcachedKeys := make([]string, 0, end-start)
+		for _, key := range keys[start:end] {
+			memcachedKeys = append(memcachedKeys, namespacePrefix+key)
+		}
+		items, err := c.Client.GetMulti(memcachedKeys)
+		if err != nil {
+			return convertMemcacheError(err)
+		}
+		for _, key := range keys[start:end] {
+			if _, found := items[namespacePrefix+key]; !found {
+				c.index.remove(key)
+				continue
+			}
+			if !fn(key) {
+				return nil
+			}
+		}
+	}
+	return nil
 }
 
+//Flush invalidates every item of every server with flush_all, even items of other applications, or only the keys of
+// MemcachedOptions.Namespace if set
 func (c *MemcachedStore) Flush() error {
-	return ErrNotSupport
+	return c.FlushContext(context.Background())
 }
 
-func (c *MemcachedStore) invoke(storeFn func(*memcache.Client, *memcache.Item) error,
-	key string, value interface{}, expire time.Duration) error {
+func (c *MemcachedStore) FlushContext(ctx context.Context) error {
+	if c.namespace != nil {
+		return c.run(ctx, c.namespace.Flush)
+	}
+	return c.run(ctx, func() error {
+		return c.servers.Each(c.flushAll)
+	})
+}
 
-	switch expire {
-	case DEFAULT:
-		expire = c.defaultExpiration
-	case NEVER:
-		expire = time.Duration(0)
+// flushAll sends flush_all to addr, with the delay of the store if any
+func (c *MemcachedStore) flushAll(addr net.Addr) error {
+	conn, err := net.DialTimeout(addr.Network(), addr.String(), c.Client.Timeout)
+	if err != nil {
+		return err
 	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(c.Client.Timeout))
+
+	command := "flush_all\r\n"
+	if c.flushDelay > 0 {
+		command = fmt.Sprintf("flush_all %d\r\n", int64((c.flushDelay+time.Second-1)/time.Second))
+	}
+	if _, err := io.WriteString(conn, command); err != nil {
+		return err
+	}
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return err
+	}
+	if line != "OK\r\n" {
+		return fmt.Errorf("cache: flush_all failed on %s: %s", addr, strings.TrimSpace(line))
+	}
+	return nil
+}
+
+// run calls fn until ctx is done. gomemcache doesn't take a context, fn keeps running in background after ctx
+// is done until it succeeds or hits Client.Timeout, its results must only be read if run returns nil.
+func (c *MemcachedStore) run(ctx context.Context, fn func() error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if ctx.Done() == nil {
+		// Never done
+		return fn()
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- fn()
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (c *MemcachedStore) invoke(ctx context.Context, storeFn func(*memcache.Client, *memcache.Item) error,
+	key string, value interface{}, expire time.Duration) error {
 
 	b, err := serialize(value)
 	if err != nil {
 		return err
 	}
-	return convertMemcacheError(storeFn(c.Client, &memcache.Item{
-		Key:        key,
+	memcachedKey, err := c.key(key)
+	if err != nil {
+		return err
+	}
+	item := &memcache.Item{
+		Key:        memcachedKey,
 		Value:      b,
-		Expiration: int32(expire / time.Second),
+		Expiration: c.expiration(expire),
+	}
+	err = convertMemcacheError(c.run(ctx, func() error {
+		return storeFn(c.Client, item)
 	}))
+	if err == nil {
+		c.index.add(key)
+	}
+	return err
+}
+
+// memcachedMaxRelativeExpiration longest expiration in seconds read as relative by memcached, longer ones are read
+// as unix timestamps
+const memcachedMaxRelativeExpiration = 30 * 24 * 60 * 60
+
+// memcachedMaxKeyLength longest key accepted by memcached, in bytes
+const memcachedMaxKeyLength = 250
+
+func (c *MemcachedStore) expiration(expire time.Duration) int32 {
+	return memcachedExpiration(expire, c.defaultExpiration)
+}
+
+// memcachedExpiration converts expire to the expiration of memcached: seconds rounded up so that a sub-second ttl
+// still expires, or a unix timestamp beyond 30 days
+func memcachedExpiration(expire time.Duration, defaultExpiration time.Duration) int32 {
+	switch expire {
+	case DEFAULT:
+		expire = defaultExpiration
+	case NEVER:
+		expire = time.Duration(0)
+	}
+
+	seconds := int64((expire + time.Second - 1) / time.Second)
+	if seconds > memcachedMaxRelativeExpiration {
+		seconds += time.Now().Unix()
+		if seconds > math.MaxInt32 {
+			seconds = math.MaxInt32
+		}
+	}
+	return int32(seconds)
 }
 
 func convertMemcacheError(err error) error {
@@ -82,7 +495,41 @@ func convertMemcacheError(err error) error {
 		return ErrCacheMiss
 	case memcache.ErrNotStored:
 		return ErrNotStored
+	case memcache.ErrCASConflict:
+		return ErrCASConflict
 	}
 
 	return err
 }
+
+func (i *keyIndex) add(key string) {
+	if i == nil {
+		return
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.keys[key] = struct{}{}
+}
+
+func (i *keyIndex) remove(key string) {
+	if i == nil {
+		return
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	delete(i.keys, key)
+}
+
+// scan returns the keys starting with prefix
+func (i *keyIndex) scan(prefix string) []string {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	var keys []string
+	for key := range i.keys {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
@@ -0,0 +1,76 @@
+package cache
+
+import (
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/bradfitz/gomemcache/memcache"
+)
+
+//KetamaSelector memcache.ServerSelector picking the server of a key on a HashRing instead of the modulo of
+// memcache.ServerList, adding or removing a server only remaps the keys of its points. Safe for concurrent use.
+type KetamaSelector struct {
+	mu    sync.RWMutex
+	ring  *HashRing
+	addrs map[string]net.Addr
+}
+
+//NewKetamaSelector create a KetamaSelector without servers
+func NewKetamaSelector() *KetamaSelector {
+	return &KetamaSelector{ring: NewHashRing(0), addrs: map[string]net.Addr{}}
+}
+
+//SetServers replaces the servers with the servers of weights, a weight <= 0 counts as 1. Like
+// memcache.ServerList.SetServers, an address containing a "/" is a unix socket and no change is made if an address
+// doesn't resolve.
+func (s *KetamaSelector) SetServers(weights map[string]int) error {
+	ring := NewHashRing(0)
+	addrs := make(map[string]net.Addr, len(weights))
+	for server, weight := range weights {
+		addr, err := resolveMemcachedAddr(server)
+		if err != nil {
+			return err
+		}
+		addrs[server] = addr
+		ring.Add(server, weight)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ring, s.addrs = ring, addrs
+	return nil
+}
+
+//PickServer returns the server of key, memcache.ErrNoServers if there is none
+func (s *KetamaSelector) PickServer(key string) (net.Addr, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	server, found := s.ring.Get(key)
+	if !found {
+		return nil, memcache.ErrNoServers
+	}
+	return s.addrs[server], nil
+}
+
+//Each calls f for every server sorted by address until it returns an error
+func (s *KetamaSelector) Each(f func(net.Addr) error) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, server := range s.ring.Nodes() {
+		if err := f(s.addrs[server]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolveMemcachedAddr resolves server like memcache.ServerList
+func resolveMemcachedAddr(server string) (net.Addr, error) {
+	if strings.Contains(server, "/") {
+		return net.ResolveUnixAddr("unix", server)
+	}
+	return net.ResolveTCPAddr("tcp", server)
+}
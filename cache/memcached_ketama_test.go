@@ -0,0 +1,103 @@
+package cache
+
+import (
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/bradfitz/gomemcache/memcache"
+	"github.com/stretchr/testify/assert"
+)
+
+func selectorKeys(t *testing.T, selector memcache.ServerSelector, n int) map[string]string {
+	servers := map[string]string{}
+	for i := 0; i < n; i++ {
+		key := "key" + strconv.Itoa(i)
+		addr, err := selector.PickServer(key)
+		if assert.NoError(t, err) {
+			servers[key] = addr.String()
+		}
+	}
+	return servers
+}
+
+func TestKetamaSelector(t *testing.T) {
+	selector := NewKetamaSelector()
+	_, err := selector.PickServer("key")
+	assert.Equal(t, memcache.ErrNoServers, err)
+
+	assert.NoError(t, selector.SetServers(map[string]int{"127.0.0.1:11211": 1, "127.0.0.1:11212": 1, "127.0.0.1:11213": 2}))
+	var each []string
+	assert.NoError(t, selector.Each(func(addr net.Addr) error {
+		each = append(each, addr.String())
+		return nil
+	}))
+	assert.Equal(t, []string{"127.0.0.1:11211", "127.0.0.1:11212", "127.0.0.1:11213"}, each)
+
+	// Spread by weight
+	before := selectorKeys(t, selector, 10000)
+	counts := map[string]int{}
+	for _, server := range before {
+		counts[server]++
+	}
+	assert.InDelta(t, 2500, counts["127.0.0.1:11211"], 500)
+	assert.InDelta(t, 2500, counts["127.0.0.1:11212"], 500)
+	assert.InDelta(t, 5000, counts["127.0.0.1:11213"], 500)
+
+	// Only the keys of the new server move
+	assert.NoError(t, selector.SetServers(map[string]int{"127.0.0.1:11211": 1, "127.0.0.1:11212": 1, "127.0.0.1:11213": 2, "127.0.0.1:11214": 1}))
+	moved := 0
+	for key, server := range selectorKeys(t, selector, 10000) {
+		if server != before[key] {
+			moved++
+			assert.Equal(t, "127.0.0.1:11214", server)
+		}
+	}
+	assert.InDelta(t, 2000, moved, 500)
+
+	// Nothing changes if an address doesn't resolve
+	assert.Error(t, selector.SetServers(map[string]int{"127.0.0.1:11211": 1, "invalid:port": 1}))
+	assert.Len(t, selector.ring.Nodes(), 4)
+}
+
+var newMemcachedKetamaStore = func(t *testing.T, defaultExpiration time.Duration) Store {
+	newMemcachedStore(t, defaultExpiration)
+	return NewMemcachedStoreWithOptions(MemcachedOptions{
+		Hosts:             []string{memcacheTestServer},
+		Ketama:            true,
+		Weights:           map[string]int{memcacheTestServer: 2},
+		Timeout:           time.Second,
+		MaxIdleConns:      10,
+		DefaultExpiration: defaultExpiration,
+	})
+}
+
+func TestMemcachedKetamaCache_TypicalGetSet(t *testing.T) {
+	typicalGetSet(t, newMemcachedKetamaStore)
+}
+
+func TestMemcachedKetamaCache_Batch(t *testing.T) {
+	testBatch(t, newMemcachedKetamaStore)
+}
+
+func TestMemcachedKetamaCache_Flush(t *testing.T) {
+	cache := newMemcachedKetamaStore(t, time.Hour)
+
+	var get int
+	assert.NoError(t, cache.Set("int", 1, DEFAULT))
+	assert.NoError(t, cache.Flush())
+	assert.Equal(t, ErrCacheMiss, cache.Get("int", &get))
+}
+
+func TestMemcachedStore_Options(t *testing.T) {
+	cache := NewMemcachedStore([]string{memcacheTestServer}, time.Hour)
+	assert.Equal(t, memcache.DefaultTimeout, cache.Timeout)
+	assert.Equal(t, memcache.DefaultMaxIdleConns, cache.MaxIdleConns)
+	assert.IsType(t, &memcache.ServerList{}, cache.servers)
+
+	cache = newMemcachedKetamaStore(t, time.Hour).(*MemcachedStore)
+	assert.Equal(t, time.Second, cache.Timeout)
+	assert.Equal(t, 10, cache.MaxIdleConns)
+	assert.IsType(t, &KetamaSelector{}, cache.servers)
+}
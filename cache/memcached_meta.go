@@ -0,0 +1,508 @@
+package cache
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bradfitz/gomemcache/memcache"
+)
+
+//MemcachedMetaOptions Struct for Configure MemcachedMetaStore
+type MemcachedMetaOptions struct {
+	//Hosts addresses of the memcached servers, 1.6.10 or later
+	Hosts []string
+
+	//Ketama spreads the keys over Hosts with a KetamaSelector instead of a modulo like gomemcache (Default: false)
+	Ketama bool
+
+	//Weights weight of the hosts with Ketama, hosts missing from Weights have a weight of 1 (Default: nil)
+	Weights map[string]int
+
+	//Timeout timeout for dialing a server, reading a reply and writing a command, a deadline of the context of a
+	// command shortens it (Default: 100ms)
+	Timeout time.Duration
+
+	//MaxIdleConns max number of idle connections kept by server (Default: 2)
+	MaxIdleConns int
+
+	//DefaultExpiration ttl used when storing a value with DEFAULT
+	DefaultExpiration time.Duration
+
+	//Recache GetLease hands out the revalidation of a value to one caller once its remaining ttl is lower, the
+	// others keep getting it until it is stored again. 0 disables it, values are only won once stale (Default: 0).
+	Recache time.Duration
+
+	//LeaseTimeout ttl of the empty item created by GetLease on a miss for the caller which won it, the others wait
+	// for the value until it is stored or the item expires (Default: 10s)
+	LeaseTimeout time.Duration
+}
+
+//MemcachedMetaStore talks to memcached with the meta commands (mg, ms, md and ma) of memcached 1.6.10 or later, the
+// first release with the HD / NF / EN replies and the ms <key> <datalen> syntax. Values marked stale by Invalidate
+// are kept by memcached which hands out their revalidation to a single client, see LeaseStore.
+type MemcachedMetaStore struct {
+	servers           memcache.ServerSelector
+	timeout           time.Duration
+	maxIdleConns      int
+	defaultExpiration time.Duration
+	recache           time.Duration
+	leaseTimeout      time.Duration
+
+	mu   sync.Mutex
+	idle map[string][]*metaConn
+}
+
+// metaConn connection to a memcached server
+type metaConn struct {
+	nc   net.Conn
+	rw   *bufio.ReadWriter
+	addr net.Addr
+}
+
+// metaReply reply to a meta command, status is VA, HD, EN, NF, NS, EX or OK (flush_all)
+type metaReply struct {
+	status string
+	flags  map[byte]string
+	value  []byte
+}
+
+// metaLeaseRetryDelay delay between two mg of GetLease while another caller holds the lease of a missing key
+const metaLeaseRetryDelay = 20 * time.Millisecond
+
+// metaCASToken version of CASToken returned by MemcachedMetaStore.Gets
+type metaCASToken struct {
+	key string
+	cas string
+}
+
+//NewMemcachedMetaStore create a MemcachedMetaStore configured with options
+func NewMemcachedMetaStore(options MemcachedMetaOptions) *MemcachedMetaStore {
+	// Defaults
+	if options.Timeout <= 0 {
+		options.Timeout = memcache.DefaultTimeout
+	}
+	if options.MaxIdleConns <= 0 {
+		options.MaxIdleConns = memcache.DefaultMaxIdleConns
+	}
+	if options.LeaseTimeout <= 0 {
+		options.LeaseTimeout = 10 * time.Second
+	}
+
+	return &MemcachedMetaStore{
+		servers:           newMemcachedServers(options.Hosts, options.Ketama, options.Weights),
+		timeout:           options.Timeout,
+		maxIdleConns:      options.MaxIdleConns,
+		defaultExpiration: options.DefaultExpiration,
+		recache:           options.Recache,
+		leaseTimeout:      options.LeaseTimeout,
+		idle:              map[string][]*metaConn{},
+	}
+}
+
+//Close closes the idle connections
+func (c *MemcachedMetaStore) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for addr, conns := range c.idle {
+		for _, conn := range conns {
+			_ = conn.nc.Close()
+		}
+		delete(c.idle, addr)
+	}
+	return nil
+}
+
+func (c *MemcachedMetaStore) Get(key string, value interface{}) error {
+	return c.GetContext(context.Background(), key, value)
+}
+
+func (c *MemcachedMetaStore) GetContext(ctx context.Context, key string, value interface{}) error {
+	reply, err := c.do(ctx, "mg", key, nil, "v")
+	if err != nil {
+		return err
+	}
+	if reply.leased() {
+		return ErrCacheMiss
+	}
+	return deserialize(reply.value, value)
+}
+
+//GetLease gets the value of key with the X (stale) and W (win) flags of mg, and asks to win it ahead of its
+// expiration with R if MemcachedMetaOptions.Recache is set. A miss creates an empty item with N, the caller getting
+// W wins the key with ErrCacheMiss, the others wait for its value until it is stored or the item expires.
+func (c *MemcachedMetaStore) GetLease(ctx context.Context, key string, value interface{}) (stale bool, win bool, err error) {
+	flags := []string{"v", "N" + strconv.Itoa(int(memcachedExpiration(c.leaseTimeout, 0)))}
+	if c.recache > 0 {
+		flags = append(flags, "R"+strconv.Itoa(int(memcachedExpiration(c.recache, 0))))
+	}
+
+	for {
+		reply, err := c.do(ctx, "mg", key, nil, flags...)
+		if err != nil {
+			return false, false, err
+		}
+		_, stale = reply.flags['X']
+		_, win = reply.flags['W']
+
+		if !reply.leased() {
+			return stale, win, deserialize(reply.value, value)
+		}
+		if win {
+			return false, true, ErrCacheMiss
+		}
+
+		select {
+		case <-ctx.Done():
+			return false, false, ctx.Err()
+		case <-time.After(metaLeaseRetryDelay):
+		}
+	}
+}
+
+//Invalidate marks the value of key stale with md I
+func (c *MemcachedMetaStore) Invalidate(key string) error {
+	_, err := c.do(context.Background(), "md", key, nil, "I")
+	return err
+}
+
+func (c *MemcachedMetaStore) Set(key string, value interface{}, expires time.Duration) error {
+	return c.SetContext(context.Background(), key, value, expires)
+}
+
+func (c *MemcachedMetaStore) SetContext(ctx context.Context, key string, value interface{}, expires time.Duration) error {
+	return c.store(ctx, key, value, expires, "MS")
+}
+
+func (c *MemcachedMetaStore) Add(key string, value interface{}, expires time.Duration) error {
+	return c.AddContext(context.Background(), key, value, expires)
+}
+
+func (c *MemcachedMetaStore) AddContext(ctx context.Context, key string, value interface{}, expires time.Duration) error {
+	return c.store(ctx, key, value, expires, "ME")
+}
+
+func (c *MemcachedMetaStore) Replace(key string, value interface{}, expires time.Duration) error {
+	return c.ReplaceContext(context.Background(), key, value, expires)
+}
+
+func (c *MemcachedMetaStore) ReplaceContext(ctx context.Context, key string, value interface{}, expires time.Duration) error {
+	return c.store(ctx, key, value, expires, "MR")
+}
+
+func (c *MemcachedMetaStore) Delete(key string) error {
+	return c.DeleteContext(context.Background(), key)
+}
+
+func (c *MemcachedMetaStore) DeleteContext(ctx context.Context, key string) error {
+	_, err := c.do(ctx, "md", key, nil)
+	return err
+}
+
+func (c *MemcachedMetaStore) Increment(key string, delta uint64) (uint64, error) {
+	return c.IncrementContext(context.Background(), key, delta)
+}
+
+func (c *MemcachedMetaStore) IncrementContext(ctx context.Context, key string, delta uint64) (uint64, error) {
+	return c.arithmetic(ctx, key, delta, "MI")
+}
+
+func (c *MemcachedMetaStore) Decrement(key string, delta uint64) (uint64, error) {
+	return c.DecrementContext(context.Background(), key, delta)
+}
+
+func (c *MemcachedMetaStore) DecrementContext(ctx context.Context, key string, delta uint64) (uint64, error) {
+	return c.arithmetic(ctx, key, delta, "MD")
+}
+
+// Gets uses the cas unique id of the item as version
+func (c *MemcachedMetaStore) Gets(key string, value interface{}) (CASToken, error) {
+	reply, err := c.do(context.Background(), "mg", key, nil, "v", "c")
+	if err != nil {
+		return CASToken{}, err
+	}
+	if reply.leased() {
+		return CASToken{}, ErrCacheMiss
+	}
+	return CASToken{metaCASToken{key, reply.flags['c']}}, deserialize(reply.value, value)
+}
+
+func (c *MemcachedMetaStore) CompareAndSwap(key string, value interface{}, token CASToken, expires time.Duration) error {
+	version, ok := token.version.(metaCASToken)
+	if !ok || version.key != key {
+		return ErrCASConflict
+	}
+
+	b, err := serialize(value)
+	if err != nil {
+		return err
+	}
+	_, err = c.do(context.Background(), "ms", key, b, "T"+strconv.Itoa(int(c.expiration(expires))), "C"+version.cas)
+	return err
+}
+
+//TTL reads the remaining ttl of key with the t flag of mg, rounded to the second by memcached
+func (c *MemcachedMetaStore) TTL(key string) (time.Duration, error) {
+	reply, err := c.do(context.Background(), "mg", key, nil, "t")
+	if err != nil {
+		return 0, err
+	}
+	seconds, err := strconv.Atoi(reply.flags['t'])
+	if err != nil {
+		return 0, fmt.Errorf("cache: invalid memcached ttl %q", reply.flags['t'])
+	}
+	if seconds < 0 {
+		return NEVER, nil
+	}
+	return time.Duration(seconds) * time.Second, nil
+}
+
+func (c *MemcachedMetaStore) Touch(key string, expires time.Duration) error {
+	_, err := c.do(context.Background(), "mg", key, nil, "T"+strconv.Itoa(int(c.expiration(expires))))
+	return err
+}
+
+//Flush invalidates every item of every server with flush_all, even items of other applications
+func (c *MemcachedMetaStore) Flush() error {
+	return c.FlushContext(context.Background())
+}
+
+func (c *MemcachedMetaStore) FlushContext(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return c.servers.Each(func(addr net.Addr) error {
+		return c.doOn(ctx, addr, func(rw *bufio.ReadWriter) error {
+			if _, err := rw.WriteString("flush_all\r\n"); err != nil {
+				return err
+			}
+			_, err := readMetaReply(rw)
+			return err
+		})
+	})
+}
+
+// store sends ms with mode, MS (set), ME (add) or MR (replace)
+func (c *MemcachedMetaStore) store(ctx context.Context, key string, value interface{}, expires time.Duration, mode string) error {
+	b, err := serialize(value)
+	if err != nil {
+		return err
+	}
+	_, err = c.do(ctx, "ms", key, b, "T"+strconv.Itoa(int(c.expiration(expires))), mode)
+	return err
+}
+
+// arithmetic sends ma with mode, MI (increment) or MD (decrement), and returns the new value
+func (c *MemcachedMetaStore) arithmetic(ctx context.Context, key string, delta uint64, mode string) (uint64, error) {
+	reply, err := c.do(ctx, "ma", key, nil, mode, "D"+strconv.FormatUint(delta, 10), "v")
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(string(reply.value), 10, 64)
+}
+
+func (c *MemcachedMetaStore) expiration(expires time.Duration) int32 {
+	return memcachedExpiration(expires, c.defaultExpiration)
+}
+
+// do sends the meta command "command key flags..." followed by data if not nil to the server of key. Replies EN and
+// NF are returned as ErrCacheMiss, NS as ErrNotStored and EX as ErrCASConflict.
+func (c *MemcachedMetaStore) do(ctx context.Context, command string, key string, data []byte, flags ...string) (metaReply, error) {
+	if err := ctx.Err(); err != nil {
+		return metaReply{}, err
+	}
+	addr, err := c.servers.PickServer(key)
+	if err != nil {
+		return metaReply{}, err
+	}
+
+	key, binary := metaKey(key)
+	if binary {
+		flags = append(flags, "b")
+	}
+
+	var reply metaReply
+	err = c.doOn(ctx, addr, func(rw *bufio.ReadWriter) error {
+		line := command + " " + key
+		if data != nil {
+			line += " " + strconv.Itoa(len(data))
+		}
+		if len(flags) > 0 {
+			line += " " + strings.Join(flags, " ")
+		}
+		if _, err := rw.WriteString(line + "\r\n"); err != nil {
+			return err
+		}
+		if data != nil {
+			if _, err := rw.Write(data); err != nil {
+				return err
+			}
+			if _, err := rw.WriteString("\r\n"); err != nil {
+				return err
+			}
+		}
+
+		reply, err = readMetaReply(rw)
+		return err
+	})
+	if err != nil {
+		return reply, err
+	}
+
+	switch reply.status {
+	case "EN", "NF":
+		return reply, ErrCacheMiss
+	case "NS":
+		return reply, ErrNotStored
+	case "EX":
+		return reply, ErrCASConflict
+	}
+	return reply, nil
+}
+
+// doOn calls fn with a connection to addr, it is kept for the next commands if fn succeeds
+func (c *MemcachedMetaStore) doOn(ctx context.Context, addr net.Addr, fn func(rw *bufio.ReadWriter) error) error {
+	conn, err := c.conn(addr)
+	if err != nil {
+		return err
+	}
+
+	deadline := time.Now().Add(c.timeout)
+	ctxDeadline, ok := ctx.Deadline()
+	if ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	_ = conn.nc.SetDeadline(deadline)
+
+	if err = fn(conn.rw); err == nil {
+		err = conn.rw.Flush()
+	}
+	if err != nil {
+		_ = conn.nc.Close()
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		if ok && !time.Now().Before(ctxDeadline) {
+			// The read timed out before ctx
+			return context.DeadlineExceeded
+		}
+		return err
+	}
+	c.release(conn)
+	return nil
+}
+
+// conn returns an idle connection to addr or dials a new one
+func (c *MemcachedMetaStore) conn(addr net.Addr) (*metaConn, error) {
+	c.mu.Lock()
+	if conns := c.idle[addr.String()]; len(conns) > 0 {
+		conn := conns[len(conns)-1]
+		c.idle[addr.String()] = conns[:len(conns)-1]
+		c.mu.Unlock()
+		return conn, nil
+	}
+	c.mu.Unlock()
+
+	nc, err := net.DialTimeout(addr.Network(), addr.String(), c.timeout)
+	if err != nil {
+		return nil, err
+	}
+	return &metaConn{nc: nc, rw: bufio.NewReadWriter(bufio.NewReader(nc), bufio.NewWriter(nc)), addr: addr}, nil
+}
+
+// release keeps conn for the next commands, or closes it if there are MaxIdleConns idle connections already
+func (c *MemcachedMetaStore) release(conn *metaConn) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if conns := c.idle[conn.addr.String()]; len(conns) < c.maxIdleConns {
+		c.idle[conn.addr.String()] = append(conns, conn)
+		return
+	}
+	_ = conn.nc.Close()
+}
+
+// readMetaReply reads the reply to a meta command, an error reply of memcached is returned as an error
+func readMetaReply(rw *bufio.ReadWriter) (metaReply, error) {
+	if err := rw.Flush(); err != nil {
+		return metaReply{}, err
+	}
+	line, err := rw.ReadString('\n')
+	if err != nil {
+		return metaReply{}, err
+	}
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return metaReply{}, fmt.Errorf("cache: invalid memcached reply %q", line)
+	}
+
+	reply := metaReply{status: fields[0], flags: map[byte]string{}}
+	switch reply.status {
+	case "VA":
+		if len(fields) < 2 {
+			return reply, fmt.Errorf("cache: invalid memcached reply %q", line)
+		}
+		size, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return reply, fmt.Errorf("cache: invalid memcached reply %q", line)
+		}
+		reply.value = make([]byte, size+2)
+		if _, err := io.ReadFull(rw, reply.value); err != nil {
+			return reply, err
+		}
+		reply.value = reply.value[:size]
+		fields = fields[2:]
+	case "HD", "EN", "NF", "NS", "EX", "OK":
+		fields = fields[1:]
+	default:
+		return reply, fmt.Errorf("cache: memcached error: %s", strings.TrimSpace(line))
+	}
+
+	for _, flag := range fields {
+		reply.flags[flag[0]] = flag[1:]
+	}
+	return reply, nil
+}
+
+// leased returns true for the empty item created by a mg with N on a miss, until its value is stored. Unlike a stored
+// value marked stale, it isn't flagged X.
+func (r metaReply) leased() bool {
+	_, stale := r.flags['X']
+	_, win := r.flags['W']
+	_, won := r.flags['Z']
+	return len(r.value) == 0 && !stale && (win || won)
+}
+
+// metaKey returns the key sent for key and true if it is in base64 (b flag). Keys memcached can't read are sent in
+// base64, the ones still longer than 250 bytes once encoded as the sha1 of key.
+func metaKey(key string) (string, bool) {
+	if legalMemcachedKey(key) {
+		return key, false
+	}
+	if encoded := base64.StdEncoding.EncodeToString([]byte(key)); len(encoded) <= memcachedMaxKeyLength {
+		return encoded, true
+	}
+	// Starts with a byte printable keys don't have
+	sum := sha1.Sum([]byte(key))
+	return base64.StdEncoding.EncodeToString(append([]byte{0}, sum[:]...)), true
+}
+
+// legalMemcachedKey returns true if key can be sent as is, like gomemcache
+func legalMemcachedKey(key string) bool {
+	if len(key) == 0 || len(key) > memcachedMaxKeyLength {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] <= ' ' || key[i] == 0x7f {
+			return false
+		}
+	}
+	return true
+}
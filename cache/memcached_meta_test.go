@@ -0,0 +1,469 @@
+package cache
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeMemcachedMeta memcached stand-in speaking the meta commands used by MemcachedMetaStore
+type fakeMemcachedMeta struct {
+	listener net.Listener
+
+	mu    sync.Mutex
+	items map[string]*fakeMetaItem
+	cas   uint64
+}
+
+// fakeMetaItem item of fakeMemcachedMeta, won is set once a W flag was sent for it, vivified for an item created by
+// mg with N until it is stored
+type fakeMetaItem struct {
+	value    []byte
+	exp      time.Time
+	cas      uint64
+	stale    bool
+	won      bool
+	vivified bool
+}
+
+func newFakeMemcachedMeta(t *testing.T) *fakeMemcachedMeta {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &fakeMemcachedMeta{listener: listener, items: map[string]*fakeMetaItem{}}
+	go m.serve()
+	return m
+}
+
+func (m *fakeMemcachedMeta) addr() string {
+	return m.listener.Addr().String()
+}
+
+func (m *fakeMemcachedMeta) serve() {
+	for {
+		conn, err := m.listener.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+			r, w := bufio.NewReader(conn), bufio.NewWriter(conn)
+			for {
+				line, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				fields := strings.Fields(line)
+				if len(fields) == 0 {
+					return
+				}
+
+				var data []byte
+				if fields[0] == "ms" && len(fields) > 2 {
+					size, _ := strconv.Atoi(fields[2])
+					data = make([]byte, size+2)
+					if _, err := io.ReadFull(r, data); err != nil {
+						return
+					}
+					data = data[:size]
+				}
+
+				_, _ = w.WriteString(m.do(fields, data))
+				if w.Flush() != nil {
+					return
+				}
+			}
+		}()
+	}
+}
+
+// do runs a command and returns its reply
+func (m *fakeMemcachedMeta) do(fields []string, data []byte) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if fields[0] == "flush_all" {
+		m.items = map[string]*fakeMetaItem{}
+		return "OK\r\n"
+	}
+	if len(fields) < 2 {
+		return "ERROR\r\n"
+	}
+
+	if len(fields[1]) > memcachedMaxKeyLength {
+		return "CLIENT_ERROR bad command line format\r\n"
+	}
+
+	key, args := fields[1], fields[2:]
+	if fields[0] == "ms" {
+		args = args[1:]
+	}
+	flags := map[byte]string{}
+	for _, arg := range args {
+		flags[arg[0]] = arg[1:]
+	}
+	if _, ok := flags['b']; ok {
+		decoded, err := base64.StdEncoding.DecodeString(key)
+		if err != nil {
+			return "CLIENT_ERROR bad data chunk\r\n"
+		}
+		key = string(decoded)
+	}
+
+	item := m.items[key]
+	if item != nil && !item.exp.IsZero() && !time.Now().Before(item.exp) {
+		delete(m.items, key)
+		item = nil
+	}
+
+	switch fields[0] {
+	case "mg":
+		if ttl, ok := flags['N']; ok && item == nil {
+			m.cas++
+			item = &fakeMetaItem{value: []byte{}, exp: fakeMetaExpiration(ttl), cas: m.cas, vivified: true}
+			m.items[key] = item
+		}
+		return m.get(item, flags)
+	case "ms":
+		return m.set(key, item, flags, data)
+	case "md":
+		if item == nil {
+			return "NF\r\n"
+		}
+		if _, ok := flags['I']; ok {
+			m.cas++
+			item.stale, item.won, item.cas = true, false, m.cas
+		} else {
+			delete(m.items, key)
+		}
+		return "HD\r\n"
+	case "ma":
+		return m.arithmetic(item, flags)
+	}
+	return "ERROR\r\n"
+}
+
+func (m *fakeMemcachedMeta) get(item *fakeMetaItem, flags map[byte]string) string {
+	if item == nil {
+		return "EN\r\n"
+	}
+	if ttl, ok := flags['T']; ok {
+		item.exp = fakeMetaExpiration(ttl)
+	}
+
+	var reply []string
+	recache, _ := strconv.Atoi(flags['R'])
+	_, wantsRecache := flags['R']
+	switch {
+	case item.won:
+		reply = append(reply, "Z")
+	case item.stale || item.vivified || (wantsRecache && !item.exp.IsZero() && time.Until(item.exp) < time.Duration(recache)*time.Second):
+		item.won = true
+		reply = append(reply, "W")
+	}
+	if item.stale {
+		reply = append(reply, "X")
+	}
+	if _, ok := flags['c']; ok {
+		reply = append(reply, "c"+strconv.FormatUint(item.cas, 10))
+	}
+	if _, ok := flags['t']; ok {
+		ttl := -1
+		if !item.exp.IsZero() {
+			ttl = int(time.Until(item.exp).Round(time.Second) / time.Second)
+		}
+		reply = append(reply, "t"+strconv.Itoa(ttl))
+	}
+
+	if _, ok := flags['v']; ok {
+		return fmt.Sprintf("VA %d %s\r\n%s\r\n", len(item.value), strings.Join(reply, " "), item.value)
+	}
+	return fmt.Sprintf("HD %s\r\n", strings.Join(reply, " "))
+}
+
+func (m *fakeMemcachedMeta) set(key string, item *fakeMetaItem, flags map[byte]string, data []byte) string {
+	switch {
+	case flags['M'] == "E" && item != nil:
+		return "NS\r\n"
+	case flags['M'] == "R" && item == nil:
+		return "NS\r\n"
+	}
+	if cas, ok := flags['C']; ok {
+		if item == nil {
+			return "NF\r\n"
+		}
+		if cas != strconv.FormatUint(item.cas, 10) {
+			return "EX\r\n"
+		}
+	}
+
+	m.cas++
+	m.items[key] = &fakeMetaItem{value: data, exp: fakeMetaExpiration(flags['T']), cas: m.cas}
+	return "HD\r\n"
+}
+
+func (m *fakeMemcachedMeta) arithmetic(item *fakeMetaItem, flags map[byte]string) string {
+	if item == nil {
+		return "NF\r\n"
+	}
+	value, err := strconv.ParseUint(string(item.value), 10, 64)
+	if err != nil {
+		return "CLIENT_ERROR cannot increment or decrement non-numeric value\r\n"
+	}
+	delta, _ := strconv.ParseUint(flags['D'], 10, 64)
+
+	switch {
+	case flags['M'] != "D":
+		value += delta
+	case delta > value:
+		value = 0
+	default:
+		value -= delta
+	}
+	m.cas++
+	item.value, item.cas = []byte(strconv.FormatUint(value, 10)), m.cas
+
+	if _, ok := flags['v']; ok {
+		return fmt.Sprintf("VA %d\r\n%s\r\n", len(item.value), item.value)
+	}
+	return "HD\r\n"
+}
+
+// fakeMetaExpiration converts the token of T to an expiration time, zero for none
+func fakeMetaExpiration(token string) time.Time {
+	seconds, _ := strconv.ParseInt(token, 10, 64)
+	switch {
+	case seconds <= 0:
+		return time.Time{}
+	case seconds > memcachedMaxRelativeExpiration:
+		return time.Unix(seconds, 0)
+	}
+	return time.Now().Add(time.Duration(seconds) * time.Second)
+}
+
+var (
+	memcachedMetaTestOnce   sync.Once
+	memcachedMetaTestServer *fakeMemcachedMeta
+)
+
+var newMemcachedMetaStore = func(t *testing.T, defaultExpiration time.Duration) Store {
+	memcachedMetaTestOnce.Do(func() {
+		memcachedMetaTestServer = newFakeMemcachedMeta(t)
+	})
+	cache := NewMemcachedMetaStore(MemcachedMetaOptions{
+		Hosts:             []string{memcachedMetaTestServer.addr()},
+		DefaultExpiration: defaultExpiration,
+	})
+	_ = cache.Flush()
+	return cache
+}
+
+func TestMemcachedMetaCache_TypicalGetSet(t *testing.T) {
+	typicalGetSet(t, newMemcachedMetaStore)
+}
+
+func TestMemcachedMetaCache_IncrDecr(t *testing.T) {
+	incrDecr(t, newMemcachedMetaStore)
+}
+
+func TestMemcachedMetaCache_Expiration(t *testing.T) {
+	expiration(t, newMemcachedMetaStore)
+}
+
+func TestMemcachedMetaCache_EmptyCache(t *testing.T) {
+	emptyCache(t, newMemcachedMetaStore)
+}
+
+func TestMemcachedMetaCache_Replace(t *testing.T) {
+	testReplace(t, newMemcachedMetaStore)
+}
+
+func TestMemcachedMetaCache_Add(t *testing.T) {
+	testAdd(t, newMemcachedMetaStore)
+}
+
+func TestMemcachedMetaCache_NamespaceFlush(t *testing.T) {
+	testNamespaceFlush(t, newMemcachedMetaStore)
+}
+
+func TestMemcachedMetaCache_CompareAndSwap(t *testing.T) {
+	testCAS(t, newMemcachedMetaStore)
+}
+
+func TestMemcachedMetaCache_TTL(t *testing.T) {
+	testTTL(t, newMemcachedMetaStore)
+}
+
+func TestMemcachedMetaCache_Touch(t *testing.T) {
+	testTouch(t, newMemcachedMetaStore(t, time.Hour).(TTLStore))
+}
+
+func TestMemcachedMetaCache_Context(t *testing.T) {
+	testContext(t, newMemcachedMetaStore)
+}
+
+func TestMemcachedMetaCache_ContextDeadline(t *testing.T) {
+	addr, stop := silentServer(t)
+	defer stop()
+	cache := NewMemcachedMetaStore(MemcachedMetaOptions{Hosts: []string{addr}, Timeout: time.Minute})
+	defer cache.Close()
+	testDeadline(t, cache)
+}
+
+func TestMemcachedMetaStore_Keys(t *testing.T) {
+	cache := newMemcachedMetaStore(t, time.Hour)
+
+	// Sent in base64, hashed once longer than 250 bytes
+	for _, key := range []string{"with space", "with\r\nnewline", strings.Repeat("long key ", 30)} {
+		var get string
+		assert.NoError(t, cache.Set(key, "value", DEFAULT), key)
+		assert.NoError(t, cache.Get(key, &get), key)
+		assert.Equal(t, "value", get, key)
+	}
+}
+
+func TestMemcachedMetaStore_Lease(t *testing.T) {
+	cache := newMemcachedMetaStore(t, time.Hour).(*MemcachedMetaStore)
+
+	var get int
+	assert.Equal(t, ErrCacheMiss, cache.Invalidate("int"))
+
+	// The first caller wins a missing key, the others wait for its value
+	stale, win, err := cache.GetLease(context.Background(), "int", &get)
+	assert.Equal(t, ErrCacheMiss, err)
+	assert.False(t, stale)
+	assert.True(t, win)
+	assert.Equal(t, ErrCacheMiss, cache.Get("int", &get))
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	_, _, err = cache.GetLease(ctx, "int", &get)
+	cancel()
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	waited := make(chan error)
+	go func() {
+		var get int
+		_, _, err := cache.GetLease(context.Background(), "int", &get)
+		if err == nil && get != 1 {
+			err = fmt.Errorf("got %d", get)
+		}
+		waited <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	assert.NoError(t, cache.Set("int", 1, DEFAULT))
+	assert.NoError(t, <-waited)
+
+	stale, win, err = cache.GetLease(context.Background(), "int", &get)
+	assert.NoError(t, err)
+	assert.False(t, stale)
+	assert.False(t, win)
+
+	// Only the first caller wins a stale value
+	assert.NoError(t, cache.Invalidate("int"))
+	stale, win, err = cache.GetLease(context.Background(), "int", &get)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, get)
+	assert.True(t, stale)
+	assert.True(t, win)
+	stale, win, err = cache.GetLease(context.Background(), "int", &get)
+	assert.NoError(t, err)
+	assert.True(t, stale)
+	assert.False(t, win)
+
+	// Stored again
+	assert.NoError(t, cache.Set("int", 2, DEFAULT))
+	stale, win, err = cache.GetLease(context.Background(), "int", &get)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, get)
+	assert.False(t, stale)
+	assert.False(t, win)
+
+	// Won ahead of its expiration
+	recache := NewMemcachedMetaStore(MemcachedMetaOptions{Hosts: []string{memcachedMetaTestServer.addr()}, Recache: time.Minute})
+	defer recache.Close()
+	assert.NoError(t, recache.Set("int", 3, 30*time.Second))
+	stale, win, err = recache.GetLease(context.Background(), "int", &get)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, get)
+	assert.False(t, stale)
+	assert.True(t, win)
+	_, win, err = recache.GetLease(context.Background(), "int", &get)
+	assert.NoError(t, err)
+	assert.False(t, win)
+}
+
+func TestMemcachedMetaStore_LeaseNoBody(t *testing.T) {
+	cache := newMemcachedMetaStore(t, time.Hour).(*MemcachedMetaStore)
+	calls := 0
+	handle := CacheHandlerWithConfig(CacheMiddlewareConfig{Store: cache}, func(c echo.Context) error {
+		calls++
+		return c.NoContent(http.StatusNoContent)
+	})
+
+	// The winner stores nothing, the key is released instead of being waited for until LeaseTimeout
+	assert.Equal(t, http.StatusNoContent, serveRequest(handle, echo.GET, "/api/v1/info", nil).Code)
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	res := httptest.NewRecorder()
+	assert.NoError(t, handle(echo.New().NewContext(httptest.NewRequest(echo.GET, "/api/v1/info", nil).WithContext(ctx), res)))
+	assert.Equal(t, http.StatusNoContent, res.Code)
+	assert.True(t, time.Since(start) < 500*time.Millisecond)
+	assert.Equal(t, 2, calls)
+}
+
+func TestMemcachedMetaStore_SoftPurge(t *testing.T) {
+	cache := newMemcachedMetaStore(t, time.Hour).(*MemcachedMetaStore)
+	calls, body := 0, "v1"
+	stats := &Stats{}
+	handle := CacheHandlerWithConfig(CacheMiddlewareConfig{Store: cache, Stats: stats}, func(c echo.Context) error {
+		calls++
+		return c.String(http.StatusOK, body)
+	})
+	key := DefaultCachePrefix + ":" + "%2Fapi%2Fv1%2Finfo"
+
+	assert.Equal(t, "v1", serveRequest(handle, echo.GET, "/api/v1/info", nil).Body.String())
+	body = "v2"
+	assert.Equal(t, "v1", serveRequest(handle, echo.GET, "/api/v1/info", nil).Body.String())
+
+	// Revalidated by the winner
+	assert.NoError(t, SoftPurge(cache, key))
+	assert.Equal(t, "v2", serveRequest(handle, echo.GET, "/api/v1/info", nil).Body.String())
+	assert.Equal(t, "v2", serveRequest(handle, echo.GET, "/api/v1/info", nil).Body.String())
+	assert.Equal(t, 2, calls)
+
+	// Another client won, the stale response is served
+	body = "v3"
+	assert.NoError(t, SoftPurge(cache, key))
+	var cached ResponseCache
+	_, win, err := cache.GetLease(context.Background(), key, &cached)
+	assert.NoError(t, err)
+	assert.True(t, win)
+	assert.Equal(t, "v2", serveRequest(handle, echo.GET, "/api/v1/info", nil).Body.String())
+	assert.Equal(t, 2, calls)
+	assert.Equal(t, uint64(1), stats.Snapshot().Stales)
+
+	// A conditional request wins the revalidation instead of getting 304 from the stale response
+	assert.NoError(t, cache.Set(key, cached, DEFAULT))
+	assert.NoError(t, SoftPurge(cache, key))
+	since := http.Header{"If-Modified-Since": {time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)}}
+	res := serveRequest(handle, echo.GET, "/api/v1/info", since)
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, "v3", res.Body.String())
+	assert.Equal(t, 3, calls)
+	assert.Equal(t, http.StatusNotModified, serveRequest(handle, echo.GET, "/api/v1/info", since).Code)
+	assert.Equal(t, 3, calls)
+}
@@ -4,6 +4,8 @@ import (
 	"net"
 	"testing"
 	"time"
+
+	"github.com/stretchr/testify/assert"
 )
 
 // These tests require memcached running on localhost:11211 (the default)
@@ -33,6 +35,30 @@ func TestMemcachedCache_Expiration(t *testing.T) {
 	expiration(t, newMemcachedStore)
 }
 
+func TestMemcachedCache_LongExpiration(t *testing.T) {
+	cache := newMemcachedStore(t, time.Hour)
+
+	// Read as a unix timestamp by memcached
+	set, get := 10, 0
+	assert.NoError(t, cache.Set("int", set, 31*24*time.Hour))
+	assert.NoError(t, cache.Get("int", &get))
+	assert.Equal(t, set, get)
+}
+
+func TestMemcachedStore_Expiration(t *testing.T) {
+	cache := NewMemcachedStore([]string{memcacheTestServer}, time.Hour)
+
+	assert.Equal(t, int32(3600), cache.expiration(DEFAULT))
+	assert.Equal(t, int32(0), cache.expiration(NEVER))
+	assert.Equal(t, int32(1), cache.expiration(time.Millisecond))
+	assert.Equal(t, int32(2), cache.expiration(1500*time.Millisecond))
+	assert.Equal(t, int32(30*24*60*60), cache.expiration(30*24*time.Hour))
+
+	expiration := int64(cache.expiration(31 * 24 * time.Hour))
+	at := time.Now().Add(31 * 24 * time.Hour).Unix()
+	assert.True(t, expiration >= at-1 && expiration <= at+1, "expiration: %d", expiration)
+}
+
 func TestMemcachedCache_EmptyCache(t *testing.T) {
 	emptyCache(t, newMemcachedStore)
 }
@@ -44,3 +70,120 @@ func TestMemcachedCache_Replace(t *testing.T) {
 func TestMemcachedCache_Add(t *testing.T) {
 	testAdd(t, newMemcachedStore)
 }
+
+func TestMemcachedCache_NamespaceFlush(t *testing.T) {
+	testNamespaceFlush(t, newMemcachedStore)
+}
+
+func TestMemcachedCache_Batch(t *testing.T) {
+	testBatch(t, newMemcachedStore)
+}
+
+func TestMemcachedCache_CompareAndSwap(t *testing.T) {
+	testCAS(t, newMemcachedStore)
+}
+
+func TestMemcachedCache_Touch(t *testing.T) {
+	cache := newMemcachedStore(t, time.Hour).(TTLStore)
+
+	_, err := cache.TTL("int")
+	assert.Equal(t, ErrNotSupport, err)
+	testTouch(t, cache)
+}
+
+func TestMemcachedCache_Context(t *testing.T) {
+	testContext(t, newMemcachedStore)
+}
+
+func TestMemcachedCache_ContextDeadline(t *testing.T) {
+	addr, stop := silentServer(t)
+	defer stop()
+	testDeadline(t, NewMemcachedStoreWithOptions(MemcachedOptions{Hosts: []string{addr}, Timeout: time.Minute}))
+}
+
+func TestMemcachedCache_Scan(t *testing.T) {
+	cache := newMemcachedStore(t, time.Hour).(ScanStore)
+	assert.Equal(t, ErrNotSupport, cache.Scan("", func(string) bool { return true }))
+
+	testScan(t, func(t *testing.T, defaultExpiration time.Duration) Store {
+		newMemcachedStore(t, defaultExpiration)
+		return NewMemcachedStoreWithOptions(MemcachedOptions{
+			Hosts:             []string{memcacheTestServer},
+			DefaultExpiration: defaultExpiration,
+			KeyIndex:          true,
+		})
+	})
+}
+
+func TestMemcachedCache_Flush(t *testing.T) {
+	cache := newMemcachedStore(t, time.Hour)
+
+	var get int
+	assert.NoError(t, cache.Set("int", 1, DEFAULT))
+	assert.NoError(t, cache.Flush())
+	assert.Equal(t, ErrCacheMiss, cache.Get("int", &get))
+
+	// Delayed
+	delayed := NewMemcachedStoreWithOptions(MemcachedOptions{Hosts: []string{memcacheTestServer}, FlushDelay: time.Second})
+	assert.NoError(t, delayed.Set("int", 1, DEFAULT))
+	assert.NoError(t, delayed.Flush())
+	assert.NoError(t, delayed.Get("int", &get))
+	time.Sleep(1100 * time.Millisecond)
+	assert.Equal(t, ErrCacheMiss, delayed.Get("int", &get))
+
+	// Server down
+	down := NewMemcachedStoreWithOptions(MemcachedOptions{Hosts: []string{memcacheTestServer, "127.0.0.1:1"}})
+	assert.Error(t, down.Flush())
+}
+
+var newMemcachedNamespaceStore = func(t *testing.T, defaultExpiration time.Duration) Store {
+	newMemcachedStore(t, defaultExpiration)
+	return NewMemcachedStoreWithOptions(MemcachedOptions{
+		Hosts:             []string{memcacheTestServer},
+		DefaultExpiration: defaultExpiration,
+		KeyIndex:          true,
+		Namespace:         "ns1",
+	})
+}
+
+func TestMemcachedNamespaceCache_TypicalGetSet(t *testing.T) {
+	typicalGetSet(t, newMemcachedNamespaceStore)
+}
+
+func TestMemcachedNamespaceCache_IncrDecr(t *testing.T) {
+	incrDecr(t, newMemcachedNamespaceStore)
+}
+
+func TestMemcachedNamespaceCache_Batch(t *testing.T) {
+	testBatch(t, newMemcachedNamespaceStore)
+}
+
+func TestMemcachedNamespaceCache_CompareAndSwap(t *testing.T) {
+	testCAS(t, newMemcachedNamespaceStore)
+}
+
+func TestMemcachedNamespaceCache_Scan(t *testing.T) {
+	testScan(t, newMemcachedNamespaceStore)
+}
+
+func TestMemcachedNamespaceCache_Flush(t *testing.T) {
+	ns1 := newMemcachedNamespaceStore(t, time.Hour)
+	ns2 := NewMemcachedStoreWithOptions(MemcachedOptions{Hosts: []string{memcacheTestServer}, Namespace: "ns2"})
+	other := NewMemcachedStore([]string{memcacheTestServer}, time.Hour)
+
+	// Flush an empty namespace
+	assert.NoError(t, ns1.Flush())
+
+	assert.NoError(t, other.Set("value", "foo", DEFAULT))
+	assert.NoError(t, ns1.Set("value", "foo", DEFAULT))
+	assert.NoError(t, ns2.Set("value", "foo", DEFAULT))
+
+	// Only ns1 is flushed
+	assert.NoError(t, ns1.Flush())
+
+	var get string
+	assert.Equal(t, ErrCacheMiss, ns1.Get("value", &get))
+	assert.NoError(t, ns2.Get("value", &get))
+	assert.NoError(t, other.Get("value", &get))
+	assert.Equal(t, "foo", get)
+}
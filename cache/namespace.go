@@ -0,0 +1,155 @@
+package cache
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+//NamespaceStore Wraps a Store to isolate its keys in a namespace. A generation counter kept in the Store is mixed
+// into every key, Flush increments it instead of deleting keys so it works the same way on every backend without
+// touching other data. Keys of previous generations are left to expire.
+type NamespaceStore struct {
+	store     Store
+	namespace string
+}
+
+func NewNamespaceStore(store Store, namespace string) *NamespaceStore {
+	return &NamespaceStore{store, namespace}
+}
+
+//Namespace returns the name of the namespace
+func (c *NamespaceStore) Namespace() string {
+	return c.namespace
+}
+
+func (c *NamespaceStore) generationKey() string {
+	return c.namespace + ":generation"
+}
+
+// generation returns the current generation, creating it if needed
+func (c *NamespaceStore) generation() (uint64, error) {
+	var generation uint64
+	err := c.store.Get(c.generationKey(), &generation)
+	if err != ErrCacheMiss {
+		return generation, err
+	}
+
+	// Start from the current time, an evicted counter must not bring back keys of an old generation
+	generation = uint64(time.Now().UnixNano())
+	if err := c.store.Add(c.generationKey(), generation, NEVER); err == ErrNotStored {
+		// Created concurrently
+		return c.generation()
+	} else if err != nil {
+		return 0, err
+	}
+	return generation, nil
+}
+
+func (c *NamespaceStore) prefix() (string, error) {
+	generation, err := c.generation()
+	if err != nil {
+		return "", err
+	}
+	return c.namespace + ":" + strconv.FormatUint(generation, 10) + ":", nil
+}
+
+func (c *NamespaceStore) key(key string) (string, error) {
+	prefix, err := c.prefix()
+	return prefix + key, err
+}
+
+func (c *NamespaceStore) Get(key string, value interface{}) error {
+	key, err := c.key(key)
+	if err != nil {
+		return err
+	}
+	return c.store.Get(key, value)
+}
+
+func (c *NamespaceStore) Set(key string, value interface{}, expire time.Duration) error {
+	key, err := c.key(key)
+	if err != nil {
+		return err
+	}
+	return c.store.Set(key, value, expire)
+}
+
+func (c *NamespaceStore) Add(key string, value interface{}, expire time.Duration) error {
+	key, err := c.key(key)
+	if err != nil {
+		return err
+	}
+	return c.store.Add(key, value, expire)
+}
+
+func (c *NamespaceStore) Replace(key string, value interface{}, expire time.Duration) error {
+	key, err := c.key(key)
+	if err != nil {
+		return err
+	}
+	return c.store.Replace(key, value, expire)
+}
+
+func (c *NamespaceStore) Delete(key string) error {
+	key, err := c.key(key)
+	if err != nil {
+		return err
+	}
+	return c.store.Delete(key)
+}
+
+func (c *NamespaceStore) Increment(key string, delta uint64) (uint64, error) {
+	key, err := c.key(key)
+	if err != nil {
+		return 0, err
+	}
+	return c.store.Increment(key, delta)
+}
+
+func (c *NamespaceStore) Decrement(key string, delta uint64) (uint64, error) {
+	key, err := c.key(key)
+	if err != nil {
+		return 0, err
+	}
+	return c.store.Decrement(key, delta)
+}
+
+//Flush invalidates every key of the namespace by incrementing its generation
+func (c *NamespaceStore) Flush() error {
+	_, err := c.store.Increment(c.generationKey(), 1)
+	if err == ErrCacheMiss {
+		// Nothing stored in this namespace yet
+		return nil
+	}
+	return err
+}
+
+//Scan calls fn for every key of the current generation starting with prefix, the wrapped Store must implement ScanStore
+func (c *NamespaceStore) Scan(prefix string, fn func(key string) bool) error {
+	namespacePrefix, err := c.prefix()
+	if err != nil {
+		return err
+	}
+	return Scan(c.store, namespacePrefix+prefix, func(key string) bool {
+		return fn(strings.TrimPrefix(key, namespacePrefix))
+	})
+}
+
+//TTL the wrapped Store must implement TTLStore
+func (c *NamespaceStore) TTL(key string) (time.Duration, error) {
+	key, err := c.key(key)
+	if err != nil {
+		return 0, err
+	}
+	return TTL(c.store, key)
+}
+
+//Touch the wrapped Store must implement TTLStore
+func (c *NamespaceStore) Touch(key string, expire time.Duration) error {
+	key, err := c.key(key)
+	if err != nil {
+		return err
+	}
+	return Touch(c.store, key, expire)
+}
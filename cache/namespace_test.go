@@ -0,0 +1,50 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+var newNamespaceStore = func(_ *testing.T, defaultExpiration time.Duration) Store {
+	return NewNamespaceStore(NewGoCacheStore(defaultExpiration, time.Second), "ns")
+}
+
+func TestNamespaceCache_TypicalGetSet(t *testing.T) {
+	typicalGetSet(t, newNamespaceStore)
+}
+
+func TestNamespaceCache_IncrDecr(t *testing.T) {
+	incrDecr(t, newNamespaceStore)
+}
+
+func TestNamespaceCache_Expiration(t *testing.T) {
+	expiration(t, newNamespaceStore)
+}
+
+func TestNamespaceCache_EmptyCache(t *testing.T) {
+	emptyCache(t, newNamespaceStore)
+}
+
+func TestNamespaceCache_Replace(t *testing.T) {
+	testReplace(t, newNamespaceStore)
+}
+
+func TestNamespaceCache_Add(t *testing.T) {
+	testAdd(t, newNamespaceStore)
+}
+
+func TestNamespaceCache_Batch(t *testing.T) {
+	testBatch(t, newNamespaceStore)
+}
+
+func TestNamespaceCache_TTL(t *testing.T) {
+	testTTL(t, newNamespaceStore)
+}
+
+func TestNamespaceCache_Context(t *testing.T) {
+	testContext(t, newNamespaceStore)
+}
+
+func TestNamespaceCache_Scan(t *testing.T) {
+	testScan(t, newNamespaceStore)
+}
@@ -0,0 +1,156 @@
+package cache
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+type (
+	// ban invalidates every response stored before created with a request URI matching pattern or prefix
+	ban struct {
+		pattern *regexp.Regexp
+		prefix  string
+		created time.Time
+	}
+
+	// banList keeps BAN requests in memory and check them lazily when a cached response is served (like Varnish).
+	// Bans are per process: with several instances, a BAN only invalidates the responses served by the instance
+	// receiving it.
+	banList struct {
+		sync.RWMutex
+		bans []ban
+
+		// expire ttl of cached responses, bans older than that can't match anything anymore
+		expire time.Duration
+		// floor responses stored before it are banned, raised when the oldest ban is dropped to stay under maxBans
+		floor time.Time
+	}
+)
+
+// maxBans max number of bans kept by a banList, the ttl of the cached responses is unknown with DEFAULT or NEVER
+const maxBans = 1000
+
+func newBanList(expire time.Duration) *banList {
+	return &banList{expire: expire}
+}
+
+func (b ban) match(uri string) bool {
+	if b.pattern != nil {
+		return b.pattern.MatchString(uri)
+	}
+	return strings.HasPrefix(uri, b.prefix)
+}
+
+func (l *banList) add(b ban) {
+	l.Lock()
+	defer l.Unlock()
+
+	// Drop bans older than the cached responses ttl
+	if l.expire > 0 {
+		bans := l.bans[:0]
+		for _, old := range l.bans {
+			if b.created.Sub(old.created) < l.expire {
+				bans = append(bans, old)
+			}
+		}
+		l.bans = bans
+	}
+	l.bans = append(l.bans, b)
+
+	// Dropping the oldest ban invalidates every response stored before it, whatever its URI
+	if len(l.bans) > maxBans {
+		l.floor = l.bans[0].created
+		l.bans = append(l.bans[:0], l.bans[1:]...)
+	}
+}
+
+func (l *banList) banned(cache *ResponseCache) bool {
+	l.RLock()
+	defer l.RUnlock()
+
+	if cache.Created.Before(l.floor) {
+		return true
+	}
+	for _, b := range l.bans {
+		if cache.Created.Before(b.created) && b.match(cache.URI) {
+			return true
+		}
+	}
+	return false
+}
+
+// handlePurge remove the cached response of the request URI (PURGE <uri>)
+func (r *responseCacher) handlePurge(c echo.Context) error {
+	if !r.config.PurgeAuthorizer(c) {
+		return echo.ErrForbidden
+	}
+
+	key := GetKey(r.config.KeyPrefix, c.Request())
+	if err := r.config.Store.Delete(key); err == ErrCacheMiss {
+		return c.NoContent(http.StatusNotFound)
+	} else if err != nil {
+		return err
+	}
+	return c.NoContent(http.StatusOK)
+}
+
+// handleBan invalidate every cached response with a request URI matching HeaderBanRegex or HeaderBanPrefix (BAN)
+func (r *responseCacher) handleBan(c echo.Context) error {
+	if !r.config.PurgeAuthorizer(c) {
+		return echo.ErrForbidden
+	}
+
+	b := ban{created: time.Now()}
+	if expr := c.Request().Header.Get(HeaderBanRegex); expr != "" {
+		pattern, err := regexp.Compile(expr)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		b.pattern = pattern
+	} else if prefix := c.Request().Header.Get(HeaderBanPrefix); prefix != "" {
+		b.prefix = prefix
+	} else {
+		return echo.NewHTTPError(http.StatusBadRequest, "missing "+HeaderBanRegex+" or "+HeaderBanPrefix+" header")
+	}
+
+	r.bans.add(b)
+	return c.NoContent(http.StatusOK)
+}
+
+// Scan calls fn for every key of store starting with prefix until fn returns false
+// Returns ErrNotSupport if store doesn't implement ScanStore
+func Scan(store Store, prefix string, fn func(key string) bool) error {
+	scanner, ok := store.(ScanStore)
+	if !ok {
+		return ErrNotSupport
+	}
+	return scanner.Scan(prefix, fn)
+}
+
+// PurgePrefix remove every key of store starting with prefix, returns the number of removed keys
+// Returns ErrNotSupport if store doesn't implement ScanStore
+func PurgePrefix(store Store, prefix string) (int, error) {
+	var keys []string
+	err := Scan(store, prefix, func(key string) bool {
+		keys = append(keys, key)
+		return true
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	for _, key := range keys {
+		if err := store.Delete(key); err == nil {
+			purged++
+		} else if err != ErrCacheMiss {
+			return purged, err
+		}
+	}
+	return purged, nil
+}
@@ -0,0 +1,99 @@
+package cache
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func newPurgeHandler(store Store, calls *int) echo.HandlerFunc {
+	config := CacheMiddlewareConfig{
+		Store: store,
+		PurgeAuthorizer: func(c echo.Context) bool {
+			return c.Request().Header.Get("Authorization") == "secret"
+		},
+	}
+
+	return CacheHandlerWithConfig(config, func(c echo.Context) error {
+		*calls++
+		return c.String(http.StatusOK, "😁")
+	})
+}
+
+func serveRequest(handle echo.HandlerFunc, method string, uri string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, uri, nil)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	res := httptest.NewRecorder()
+	err := handle(echo.New().NewContext(req, res))
+	if he, ok := err.(*echo.HTTPError); ok {
+		res.Code = he.Code
+	}
+	return res
+}
+
+func TestPurge(t *testing.T) {
+	calls := 0
+	handle := newPurgeHandler(NewGoCacheStore(time.Minute, time.Minute), &calls)
+	auth := http.Header{"Authorization": {"secret"}}
+
+	serveRequest(handle, echo.GET, "/api/v1/info", nil)
+	serveRequest(handle, echo.GET, "/api/v1/info", nil)
+	assert.Equal(t, 1, calls)
+
+	assert.Equal(t, http.StatusForbidden, serveRequest(handle, MethodPurge, "/api/v1/info", nil).Code)
+	assert.Equal(t, http.StatusOK, serveRequest(handle, MethodPurge, "/api/v1/info", auth).Code)
+	assert.Equal(t, http.StatusNotFound, serveRequest(handle, MethodPurge, "/api/v1/info", auth).Code)
+
+	serveRequest(handle, echo.GET, "/api/v1/info", nil)
+	assert.Equal(t, 2, calls)
+}
+
+func TestBan(t *testing.T) {
+	calls := 0
+	handle := newPurgeHandler(NewGoCacheStore(time.Minute, time.Minute), &calls)
+
+	serveRequest(handle, echo.GET, "/api/v1/info", nil)
+	serveRequest(handle, echo.GET, "/api/v2/info", nil)
+	assert.Equal(t, 2, calls)
+
+	assert.Equal(t, http.StatusBadRequest, serveRequest(handle, MethodBan, "/", http.Header{"Authorization": {"secret"}}).Code)
+	assert.Equal(t, http.StatusForbidden, serveRequest(handle, MethodBan, "/", http.Header{HeaderBanPrefix: {"/api/v1"}}).Code)
+
+	time.Sleep(time.Millisecond)
+	assert.Equal(t, http.StatusOK, serveRequest(handle, MethodBan, "/", http.Header{"Authorization": {"secret"}, HeaderBanPrefix: {"/api/v1"}}).Code)
+
+	serveRequest(handle, echo.GET, "/api/v1/info", nil)
+	serveRequest(handle, echo.GET, "/api/v2/info", nil)
+	assert.Equal(t, 3, calls)
+
+	time.Sleep(time.Millisecond)
+	assert.Equal(t, http.StatusOK, serveRequest(handle, MethodBan, "/", http.Header{"Authorization": {"secret"}, HeaderBanRegex: {"^/api/v[0-9]/"}}).Code)
+
+	serveRequest(handle, echo.GET, "/api/v1/info", nil)
+	serveRequest(handle, echo.GET, "/api/v2/info", nil)
+	assert.Equal(t, 5, calls)
+}
+
+func TestBanList_MaxBans(t *testing.T) {
+	bans := newBanList(DEFAULT)
+	stored := &ResponseCache{URI: "/api/v1/info", Created: time.Now()}
+
+	created := stored.Created.Add(time.Millisecond)
+	for i := 0; i < maxBans; i++ {
+		bans.add(ban{prefix: "/other", created: created})
+	}
+	assert.Len(t, bans.bans, maxBans)
+	assert.False(t, bans.banned(stored))
+
+	// The oldest ban is dropped, responses stored before it are banned
+	bans.add(ban{prefix: "/other", created: created.Add(time.Millisecond)})
+	assert.Len(t, bans.bans, maxBans)
+	assert.True(t, bans.banned(stored))
+	assert.False(t, bans.banned(&ResponseCache{URI: "/api/v1/info", Created: created.Add(time.Millisecond)}))
+}
@@ -1,89 +1,526 @@
 package cache
 
 import (
+	"context"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/hex"
+	"strings"
 	"time"
 
 	"github.com/gomodule/redigo/redis"
 )
 
+// compareAndSwapScript sets KEYS[1] to ARGV[2] with a ttl of ARGV[3] milliseconds (0 for none) if the sha1 of its
+// current value is ARGV[1]. Returns -1 if KEYS[1] doesn't exist, 0 if it was modified and 1 if it was set.
+var compareAndSwapScript = redis.NewScript(1, `
+local value = redis.call('GET', KEYS[1])
+if not value then
+	return -1
+end
+if redis.sha1hex(value) ~= ARGV[1] then
+	return 0
+end
+if tonumber(ARGV[3]) > 0 then
+	redis.call('SET', KEYS[1], ARGV[2], 'PX', ARGV[3])
+else
+	redis.call('SET', KEYS[1], ARGV[2])
+end
+return 1
+`)
+
+// incrementScript adds ARGV[1] to KEYS[1] without creating it, INCRBY keeps its ttl. Returns false if KEYS[1] doesn't
+// exist.
+var incrementScript = redis.NewScript(1, `
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return false
+end
+return redis.call('INCRBY', KEYS[1], ARGV[1])
+`)
+
+// decrementScript subtracts ARGV[1] from KEYS[1] without creating it or going below 0, and keeps its ttl. Returns
+// false if KEYS[1] doesn't exist.
+var decrementScript = redis.NewScript(1, `
+local value = redis.call('GET', KEYS[1])
+if not value then
+	return false
+end
+local current = tonumber(value)
+if not current then
+	return redis.error_reply('ERR value is not an integer or out of range')
+end
+if tonumber(ARGV[1]) < current then
+	return redis.call('DECRBY', KEYS[1], ARGV[1])
+end
+local ttl = redis.call('PTTL', KEYS[1])
+if ttl > 0 then
+	redis.call('SET', KEYS[1], 0, 'PX', ttl)
+else
+	redis.call('SET', KEYS[1], 0)
+end
+return 0
+`)
+
+//RedisFlushMode defines which keys are deleted by RedisStore.Flush
+type RedisFlushMode int
+
+const (
+	//RedisFlushPrefix deletes keys starting with RedisOptions.Prefix with SCAN and UNLINK
+	RedisFlushPrefix RedisFlushMode = iota
+	//RedisFlushDB deletes every key of the database with FLUSHDB, even keys of other applications
+	RedisFlushDB
+	//RedisFlushAll deletes every key of every database with FLUSHALL, even keys of other applications
+	RedisFlushAll
+)
+
+//RedisOptions Struct for Configure RedisStore
+type RedisOptions struct {
+	//Host address of the redis server, path of its socket if Network is "unix"
+	Host string
+
+	//Network "tcp" or "unix", the nodes of a cluster or a sentinel deployment are always dialed over tcp (Default: "tcp")
+	Network string
+
+	//ClusterHosts addresses of nodes of a Redis Cluster, enables the cluster mode. Host is added to them if set.
+	// The other nodes are discovered with CLUSTER SLOTS, keys are sent to the node of their hash slot.
+	ClusterHosts []string
+
+	//SentinelHosts addresses of Redis Sentinels, enables the sentinel mode, Host is ignored. The address of the master
+	// SentinelMaster is asked to the sentinels, and asked again when it fails or a +switch-master event is received.
+	SentinelHosts []string
+
+	//SentinelMaster name of the master monitored by the sentinels
+	SentinelMaster string
+
+	//SentinelPassword used for AUTH on the sentinels, no AUTH if empty
+	SentinelPassword string
+
+	//ReadFromReplicas sends Get, GetMulti, TTL and Scan to the replicas of the master in sentinel mode, the master is
+	// used if they are all down. Replication is asynchronous, see WithReadYourWrites.
+	ReadFromReplicas bool
+
+	//ReplicaHosts addresses of replicas of Host, Get, GetMulti, TTL and Scan are sent to them and to Host if the chosen
+	// one can't be reached. Replication is asynchronous, see WithReadYourWrites.
+	ReplicaHosts []string
+
+	//ReplicaBalancing defines how the replica of a read is chosen among ReplicaHosts (Default: RedisRoundRobin)
+	ReplicaBalancing RedisBalancing
+
+	//Password used for AUTH, no AUTH if empty
+	Password string
+
+	//Username used with Password for AUTH with an ACL user of redis 6, AUTH with Password only if empty or if the
+	// server is older than redis 6. Ignored without Password.
+	Username string
+
+	//DB database selected with SELECT, must be 0 in cluster mode (Default: 0)
+	DB int
+
+	//TLSConfig connects with TLS if set, its ServerName defaults to the host of the server
+	TLSConfig *tls.Config
+
+	//ConnectTimeout timeout for dialing the server (Default: 0, no timeout)
+	ConnectTimeout time.Duration
+
+	//ReadTimeout timeout for reading a reply, a deadline of the context of a command replaces it (Default: 0, no timeout)
+	ReadTimeout time.Duration
+
+	//WriteTimeout timeout for writing a command (Default: 0, no timeout)
+	WriteTimeout time.Duration
+
+	//MaxIdle max number of idle connections kept by each pool (Default: 10)
+	MaxIdle int
+
+	//MaxActive max number of connections opened by each pool (Default: 512)
+	MaxActive int
+
+	//Wait makes commands wait for a connection when MaxActive is reached instead of failing (Default: false)
+	Wait bool
+
+	//IdleTimeout idle connections are closed after this duration (Default: 3s)
+	IdleTimeout time.Duration
+
+	//MaxConnLifetime connections are closed after this duration (Default: 0, never)
+	MaxConnLifetime time.Duration
+
+	//HealthCheckInterval connections idle for longer are checked with PING when taken from their pool, every time if 0
+	// and never if negative (Default: 0)
+	HealthCheckInterval time.Duration
+
+	//DefaultExpiration ttl used when storing a value with DEFAULT
+	DefaultExpiration time.Duration
+
+	//Prefix added to every key, use it to share a redis server with other applications (Default: "")
+	Prefix string
+
+	//FlushMode defines which keys are deleted by Flush. With RedisFlushPrefix, Flush returns ErrNotSupport if Prefix
+	// is empty, deleting every key must be explicitly asked with RedisFlushDB or RedisFlushAll (Default: RedisFlushPrefix).
+	FlushMode RedisFlushMode
+
+	//HashResponses stores ResponseCache values as hashes with separate meta, header and body fields, so that
+	// GetResponseMeta reads a response without its body. Gets and CompareAndSwap don't support responses stored
+	// this way (Default: false).
+	HashResponses bool
+
+	//FlushBatchSize number of keys scanned and deleted at once by Flush with RedisFlushPrefix, also used as COUNT
+	// of the SCAN commands of Scan (Default: 1000)
+	FlushBatchSize int
+}
+
 // Wraps the Redis client to meet the Cache interface.
 type RedisStore struct {
 	pool              *redis.Pool
+	replicas          *redisReplicas
+	cluster           *redisCluster
+	sentinel          *redisSentinel
 	defaultExpiration time.Duration
+
+	prefix         string
+	flushMode      RedisFlushMode
+	flushBatchSize int
+	hashResponses  bool
 }
 
-// until redigo supports sharding/clustering, only one host will be in hostList
+// NewRedisCache connects to one host, use ShardedStore to spread keys over several hosts or RedisOptions.ClusterHosts
+// for a Redis Cluster
 func NewRedisCache(host string, password string, defaultExpiration time.Duration) *RedisStore {
-	var pool = &redis.Pool{
-		MaxIdle:     10,
-		MaxActive:   512,
-		Wait:        false,
-		IdleTimeout: 3 * time.Second,
-		Dial: func() (redis.Conn, error) {
-			// the redis protocol should probably be made sett-able
-			c, err := redis.Dial("tcp", host)
-			if err != nil {
-				return nil, err
-			}
-			if len(password) > 0 {
-				if _, err := c.Do("AUTH", password); err != nil {
-					_ = c.Close()
-					return nil, err
-				}
-			} else {
-				// check with PING
-				if _, err := c.Do("PING"); err != nil {
-					_ = c.Close()
-					return nil, err
-				}
-			}
-			return c, err
-		},
-		// custom connection test method
-		TestOnBorrow: func(c redis.Conn, t time.Time) error {
-			if _, err := c.Do("PING"); err != nil {
-				return err
+	return NewRedisCacheWithOptions(RedisOptions{
+		Host:              host,
+		Password:          password,
+		DefaultExpiration: defaultExpiration,
+	})
+}
+
+//NewRedisSentinelCache connects to the master monitored by sentinels under the name master
+func NewRedisSentinelCache(sentinels []string, master string, password string, defaultExpiration time.Duration) *RedisStore {
+	return NewRedisCacheWithOptions(RedisOptions{
+		SentinelHosts:     sentinels,
+		SentinelMaster:    master,
+		Password:          password,
+		DefaultExpiration: defaultExpiration,
+	})
+}
+
+//NewRedisCacheWithOptions create a RedisStore configured with options
+func NewRedisCacheWithOptions(options RedisOptions) *RedisStore {
+	// Defaults
+	if options.Network == "" {
+		options.Network = "tcp"
+	}
+	if options.MaxIdle <= 0 {
+		options.MaxIdle = 10
+	}
+	if options.MaxActive <= 0 {
+		options.MaxActive = 512
+	}
+	if options.IdleTimeout <= 0 {
+		options.IdleTimeout = 3 * time.Second
+	}
+
+	var cluster *redisCluster
+	host := options.Host
+	if len(options.ClusterHosts) > 0 {
+		seeds := options.ClusterHosts
+		if options.Host != "" {
+			seeds = append([]string{options.Host}, seeds...)
+		}
+		cluster = newRedisCluster(seeds, options)
+		host = seeds[0]
+	}
+
+	var sentinel *redisSentinel
+	var pool *redis.Pool
+	var replicas *redisReplicas
+	if cluster != nil {
+		// Used by RedisInvalidationBus, PUBLISH is broadcast to every node
+		pool = cluster.pool(host)
+	} else if len(options.SentinelHosts) > 0 {
+		sentinel = newRedisSentinel(options)
+		pool = newRedisPool(options, sentinel.dialMaster)
+		pool.TestOnBorrow = sentinel.testOnBorrow
+		if options.ReadFromReplicas {
+			// The replica is chosen when dialing
+			replicaPool := newRedisPool(options, sentinel.dialReplica)
+			replicaPool.TestOnBorrow = sentinel.testOnBorrow
+			replicas = &redisReplicas{pools: []*redis.Pool{replicaPool}}
+		}
+	} else {
+		pool = newRedisPool(options, func() (redis.Conn, error) {
+			return dialRedis(options.Network, host, options)
+		})
+		if len(options.ReplicaHosts) > 0 {
+			replicas = &redisReplicas{balancing: options.ReplicaBalancing}
+			for _, replica := range options.ReplicaHosts {
+				replica := replica
+				replicas.pools = append(replicas.pools, newRedisPool(options, func() (redis.Conn, error) {
+					return dialRedis(options.Network, replica, options)
+				}))
 			}
+		}
+	}
+
+	c := NewRedisCacheWithPool(pool, options)
+	c.replicas = replicas
+	c.cluster = cluster
+	c.sentinel = sentinel
+	return c
+}
+
+//NewRedisCacheWithPool create a RedisStore using the connections of pool, the connection options of options are ignored
+func NewRedisCacheWithPool(pool *redis.Pool, options RedisOptions) *RedisStore {
+	// Defaults
+	if options.FlushBatchSize <= 0 {
+		options.FlushBatchSize = 1000
+	}
+
+	return &RedisStore{
+		pool:              pool,
+		defaultExpiration: options.DefaultExpiration,
+		prefix:            options.Prefix,
+		flushMode:         options.FlushMode,
+		flushBatchSize:    options.FlushBatchSize,
+		hashResponses:     options.HashResponses,
+	}
+}
+
+// newRedisPool create a pool of connections opened by dial, sized by options
+func newRedisPool(options RedisOptions, dial func() (redis.Conn, error)) *redis.Pool {
+	return &redis.Pool{
+		MaxIdle:         options.MaxIdle,
+		MaxActive:       options.MaxActive,
+		Wait:            options.Wait,
+		IdleTimeout:     options.IdleTimeout,
+		MaxConnLifetime: options.MaxConnLifetime,
+		Dial:            dial,
+		TestOnBorrow:    redisHealthCheck(options.HealthCheckInterval),
+	}
+}
+
+// redisHealthCheck returns a TestOnBorrow checking with PING the connections idle for longer than interval
+func redisHealthCheck(interval time.Duration) func(c redis.Conn, t time.Time) error {
+	return func(c redis.Conn, t time.Time) error {
+		if interval < 0 || time.Since(t) < interval {
 			return nil
-		},
+		}
+		_, err := c.Do("PING")
+		return err
+	}
+}
+
+// dialRedis connects to host, authenticates and selects options.DB
+func dialRedis(network string, host string, options RedisOptions) (redis.Conn, error) {
+	c, err := redis.Dial(network, host,
+		redis.DialConnectTimeout(options.ConnectTimeout),
+		redis.DialReadTimeout(options.ReadTimeout),
+		redis.DialWriteTimeout(options.WriteTimeout),
+		redis.DialUseTLS(options.TLSConfig != nil),
+		redis.DialTLSConfig(options.TLSConfig),
+	)
+	if err != nil {
+		return nil, err
 	}
-	return &RedisStore{pool, defaultExpiration}
+
+	switch {
+	case len(options.Password) > 0 && len(options.Username) > 0:
+		_, err = c.Do("AUTH", options.Username, options.Password)
+		if redisErr, ok := err.(redis.Error); ok && strings.Contains(string(redisErr), "wrong number of arguments") {
+			// Older than redis 6, without ACL users
+			_, err = c.Do("AUTH", options.Password)
+		}
+	case len(options.Password) > 0:
+		_, err = c.Do("AUTH", options.Password)
+	default:
+		// check with PING
+		_, err = c.Do("PING")
+	}
+	if err == nil && options.DB != 0 {
+		_, err = c.Do("SELECT", options.DB)
+	}
+	if err != nil {
+		_ = c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// contextConn bounds every command by the deadline of ctx
+type contextConn struct {
+	redis.Conn
+	ctx context.Context
+}
+
+func (c contextConn) Do(commandName string, args ...interface{}) (interface{}, error) {
+	if err := c.ctx.Err(); err != nil {
+		return nil, err
+	}
+	deadline, ok := c.ctx.Deadline()
+	if !ok {
+		return c.Conn.Do(commandName, args...)
+	}
+	timeout := time.Until(deadline)
+	if timeout <= 0 {
+		return nil, context.DeadlineExceeded
+	}
+	reply, err := redis.DoWithTimeout(c.Conn, timeout, commandName, args...)
+	if err != nil && (c.ctx.Err() != nil || !time.Now().Before(deadline)) {
+		// Report the deadline instead of the read timeout, which may come first
+		if err := c.ctx.Err(); err != nil {
+			return nil, err
+		}
+		return nil, context.DeadlineExceeded
+	}
+	return reply, err
+}
+
+// getConn gets a connection from pool until ctx is done. The pool dials and checks connections without ctx, a
+// connection it returns once ctx is done is put back.
+func getConn(ctx context.Context, pool *redis.Pool) (redis.Conn, error) {
+	if ctx.Done() == nil {
+		// Never done
+		return pool.GetContext(ctx)
+	}
+
+	type result struct {
+		conn redis.Conn
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		conn, err := pool.GetContext(ctx)
+		done <- result{conn, err}
+	}()
+	select {
+	case r := <-done:
+		return r.conn, r.err
+	case <-ctx.Done():
+		go func() {
+			if r := <-done; r.err == nil {
+				_ = r.conn.Close()
+			}
+		}()
+		return nil, ctx.Err()
+	}
+}
+
+// conn gets a connection from the pool, waiting for it and running commands until ctx is done. In cluster mode
+// the connection sends every command to the node of its keys.
+func (c *RedisStore) conn(ctx context.Context) (redis.Conn, error) {
+	wrote(ctx)
+	return c.primaryConn(ctx)
+}
+
+func (c *RedisStore) primaryConn(ctx context.Context) (redis.Conn, error) {
+	if c.cluster != nil {
+		return &clusterConn{cluster: c.cluster, ctx: ctx}, nil
+	}
+	conn, err := getConn(ctx, c.pool)
+	if err != nil {
+		return nil, err
+	}
+	return contextConn{conn, ctx}, nil
+}
+
+// readConn same as conn, connected to a replica if there are some and ctx didn't write with WithReadYourWrites. The
+// primary is used if the replica can't be reached.
+func (c *RedisStore) readConn(ctx context.Context) (redis.Conn, error) {
+	if c.replicas == nil || readsPrimary(ctx) {
+		return c.primaryConn(ctx)
+	}
+	conn, err := getConn(ctx, c.replicas.pool())
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return c.primaryConn(ctx)
+	}
+	return contextConn{conn, ctx}, nil
+}
+
+//Close closes the connections of the store and stops watching the sentinels
+func (c *RedisStore) Close() error {
+	if c.sentinel != nil {
+		c.sentinel.close()
+	}
+	if c.replicas != nil {
+		c.replicas.close()
+	}
+	if c.cluster != nil {
+		c.cluster.close()
+	}
+	return c.pool.Close()
+}
+
+// key add the store prefix to key
+func (c *RedisStore) key(key string) string {
+	return c.prefix + key
 }
 
 func (c *RedisStore) Set(key string, value interface{}, expires time.Duration) error {
-	conn := c.pool.Get()
+	return c.SetContext(context.Background(), key, value, expires)
+}
+
+func (c *RedisStore) SetContext(ctx context.Context, key string, value interface{}, expires time.Duration) error {
+	conn, err := c.conn(ctx)
+	if err != nil {
+		return err
+	}
 	defer conn.Close()
-	return c.invoke(conn.Do, key, value, expires)
+	_, err = c.invoke(conn.Do, c.key(key), value, expires)
+	return err
 }
 
 func (c *RedisStore) Add(key string, value interface{}, expires time.Duration) error {
-	conn := c.pool.Get()
+	return c.AddContext(context.Background(), key, value, expires)
+}
+
+func (c *RedisStore) AddContext(ctx context.Context, key string, value interface{}, expires time.Duration) error {
+	conn, err := c.conn(ctx)
+	if err != nil {
+		return err
+	}
 	defer conn.Close()
-	if exists(conn, key) {
+	stored, err := c.invoke(conn.Do, c.key(key), value, expires, "NX")
+	if err == nil && !stored {
 		return ErrNotStored
 	}
-	return c.invoke(conn.Do, key, value, expires)
+	return err
 }
 
 func (c *RedisStore) Replace(key string, value interface{}, expires time.Duration) error {
-	conn := c.pool.Get()
+	return c.ReplaceContext(context.Background(), key, value, expires)
+}
+
+func (c *RedisStore) ReplaceContext(ctx context.Context, key string, value interface{}, expires time.Duration) error {
+	conn, err := c.conn(ctx)
+	if err != nil {
+		return err
+	}
 	defer conn.Close()
-	if !exists(conn, key) {
+	stored, err := c.invoke(conn.Do, c.key(key), value, expires, "XX")
+	if err == nil && (!stored || value == nil) {
 		return ErrNotStored
 	}
-	err := c.invoke(conn.Do, key, value, expires)
-	if value == nil {
-		return ErrNotStored
-	} else {
-		return err
-	}
+	return err
 }
 
 func (c *RedisStore) Get(key string, ptrValue interface{}) error {
-	conn := c.pool.Get()
+	return c.GetContext(context.Background(), key, ptrValue)
+}
+
+func (c *RedisStore) GetContext(ctx context.Context, key string, ptrValue interface{}) error {
+	conn, err := c.readConn(ctx)
+	if err != nil {
+		return err
+	}
 	defer conn.Close()
-	raw, err := conn.Do("GET", key)
-	if raw == nil {
+	if cache, ok := ptrValue.(*ResponseCache); ok && c.hashResponses {
+		// Responses stored before HashResponses was set are strings
+		if err := c.getResponse(conn, key, cache, true); err != ErrNotSupport {
+			return err
+		}
+	}
+	raw, err := conn.Do("GET", c.key(key))
+	if raw == nil && err == nil {
 		return ErrCacheMiss
 	}
 	item, err := redis.Bytes(raw, err)
@@ -93,95 +530,436 @@ func (c *RedisStore) Get(key string, ptrValue interface{}) error {
 	return deserialize(item, ptrValue)
 }
 
-func exists(conn redis.Conn, key string) bool {
-	retval, _ := redis.Bool(conn.Do("EXISTS", key))
-	return retval
+// Gets uses the sha1 of the value as version
+func (c *RedisStore) Gets(key string, ptrValue interface{}) (CASToken, error) {
+	conn, err := c.conn(context.Background())
+	if err != nil {
+		return CASToken{}, err
+	}
+	defer conn.Close()
+	raw, err := conn.Do("GET", c.key(key))
+	if raw == nil && err == nil {
+		return CASToken{}, ErrCacheMiss
+	}
+	item, err := redis.Bytes(raw, err)
+	if err != nil {
+		return CASToken{}, err
+	}
+
+	sum := sha1.Sum(item)
+	return CASToken{hex.EncodeToString(sum[:])}, deserialize(item, ptrValue)
 }
 
-func (c *RedisStore) Delete(key string) error {
-	conn := c.pool.Get()
+func (c *RedisStore) CompareAndSwap(key string, value interface{}, token CASToken, expires time.Duration) error {
+	version, ok := token.version.(string)
+	if !ok {
+		return ErrCASConflict
+	}
+
+	b, err := serialize(value)
+	if err != nil {
+		return err
+	}
+
+	conn, err := c.conn(context.Background())
+	if err != nil {
+		return err
+	}
 	defer conn.Close()
-	if !exists(conn, key) {
+	swapped, err := redis.Int(compareAndSwapScript.Do(conn, c.key(key), version, b, milliseconds(c.expires(expires))))
+	if err != nil {
+		return err
+	}
+	switch swapped {
+	case -1:
 		return ErrCacheMiss
+	case 0:
+		return ErrCASConflict
 	}
-	_, err := conn.Do("DEL", key)
-	return err
+	return nil
 }
 
-func (c *RedisStore) Increment(key string, delta uint64) (uint64, error) {
-	conn := c.pool.Get()
+func (c *RedisStore) GetMulti(values map[string]interface{}) error {
+	if len(values) == 0 {
+		return nil
+	}
+	conn, err := c.readConn(context.Background())
+	if err != nil {
+		return err
+	}
 	defer conn.Close()
-	// Check for existance *before* increment as per the cache contract.
-	// redis will auto create the key, and we don't want that. Since we need to do increment
-	// ourselves instead of natively via INCRBY (redis doesn't support wrapping), we get the value
-	// and do the exists check this way to minimize calls to Redis
-	val, err := conn.Do("GET", key)
-	if val == nil {
-		return 0, ErrCacheMiss
+
+	keys := make([]string, 0, len(values))
+	args := make(redis.Args, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+		args = append(args, c.key(key))
 	}
-	if err == nil {
-		currentVal, err := redis.Int64(val, nil)
-		if err != nil {
-			return 0, err
+
+	items, err := redis.Values(conn.Do("MGET", args...))
+	if err != nil {
+		return err
+	}
+	for i, key := range keys {
+		if items[i] == nil {
+			// MGET returns nil for a response stored as a hash
+			if cache, ok := values[key].(*ResponseCache); ok && c.hashResponses {
+				if err := c.getResponse(conn, key, cache, true); err == nil {
+					continue
+				} else if err != ErrCacheMiss && err != ErrNotSupport {
+					return err
+				}
+			}
+			delete(values, key)
+			continue
 		}
-		var sum = currentVal + int64(delta)
-		_, err = conn.Do("SET", key, sum)
+		item, err := redis.Bytes(items[i], nil)
 		if err != nil {
-			return 0, err
+			return err
 		}
-		return uint64(sum), nil
-	} else {
+		if err := deserialize(item, values[key]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetMulti pipelines a SET / SETEX by key
+func (c *RedisStore) SetMulti(values map[string]interface{}, expires time.Duration) error {
+	if len(values) == 0 {
+		return nil
+	}
+	conn, err := c.conn(context.Background())
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	send := func(cmd string, args ...interface{}) (interface{}, error) {
+		return nil, conn.Send(cmd, args...)
+	}
+	if c.hashResponses {
+		// Responses are sent with EVALSHA, the script is loaded on every master of a cluster
+		if err := setResponseScript.Load(conn); err != nil {
+			return err
+		}
+	}
+	for key, value := range values {
+		if _, err := c.invoke(send, c.key(key), value, expires); err != nil {
+			return err
+		}
+	}
+
+	if err := conn.Flush(); err != nil {
+		return err
+	}
+	for range values {
+		if _, err := conn.Receive(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *RedisStore) DeleteMulti(keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	conn, err := c.conn(context.Background())
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	args := make(redis.Args, 0, len(keys))
+	for _, key := range keys {
+		args = append(args, c.key(key))
+	}
+	_, err = conn.Do("DEL", args...)
+	return err
+}
+
+func exists(conn redis.Conn, key string) (bool, error) {
+	return redis.Bool(conn.Do("EXISTS", key))
+}
+
+func (c *RedisStore) Delete(key string) error {
+	return c.DeleteContext(context.Background(), key)
+}
+
+func (c *RedisStore) DeleteContext(ctx context.Context, key string) error {
+	conn, err := c.conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	key = c.key(key)
+	if found, err := exists(conn, key); err != nil {
+		return err
+	} else if !found {
+		return ErrCacheMiss
+	}
+	_, err = conn.Do("DEL", key)
+	return err
+}
+
+func (c *RedisStore) Increment(key string, delta uint64) (uint64, error) {
+	return c.IncrementContext(context.Background(), key, delta)
+}
+
+func (c *RedisStore) IncrementContext(ctx context.Context, key string, delta uint64) (uint64, error) {
+	conn, err := c.conn(ctx)
+	if err != nil {
 		return 0, err
 	}
+	defer conn.Close()
+	// INCRBY would create the key, which the cache contract forbids. A delta above MaxInt64 is negative once
+	// converted, the value wraps around like an uint64.
+	return counter(incrementScript.Do(conn, c.key(key), int64(delta)))
+}
+
+func (c *RedisStore) Decrement(key string, delta uint64) (uint64, error) {
+	return c.DecrementContext(context.Background(), key, delta)
 }
 
-func (c *RedisStore) Decrement(key string, delta uint64) (newValue uint64, err error) {
-	conn := c.pool.Get()
+func (c *RedisStore) DecrementContext(ctx context.Context, key string, delta uint64) (uint64, error) {
+	conn, err := c.conn(ctx)
+	if err != nil {
+		return 0, err
+	}
 	defer conn.Close()
-	// Check for existance *before* increment as per the cache contract.
-	// redis will auto create the key, and we don't want that, hence the exists call
-	if !exists(conn, key) {
+	// Decrement contract says you can only go to 0
+	return counter(decrementScript.Do(conn, c.key(key), delta))
+}
+
+// counter converts the reply of incrementScript and decrementScript
+func counter(reply interface{}, err error) (uint64, error) {
+	if reply == nil && err == nil {
 		return 0, ErrCacheMiss
 	}
-	// Decrement contract says you can only go to 0
-	// so we go fetch the value and if the delta is greater than the amount,
-	// 0 out the value
-	currentVal, err := redis.Int64(conn.Do("GET", key))
-	if err == nil && delta > uint64(currentVal) {
-		tempint, err := redis.Int64(conn.Do("DECRBY", key, currentVal))
-		return uint64(tempint), err
+	value, err := redis.Int64(reply, err)
+	return uint64(value), err
+}
+
+func (c *RedisStore) TTL(key string) (time.Duration, error) {
+	conn, err := c.readConn(context.Background())
+	if err != nil {
+		return 0, err
 	}
-	tempint, err := redis.Int64(conn.Do("DECRBY", key, delta))
-	return uint64(tempint), err
+	defer conn.Close()
+	ttl, err := redis.Int64(conn.Do("PTTL", c.key(key)))
+	if err != nil {
+		return 0, err
+	}
+	switch ttl {
+	case -2:
+		return 0, ErrCacheMiss
+	case -1:
+		return NEVER, nil
+	}
+	return time.Duration(ttl) * time.Millisecond, nil
 }
 
-func (c *RedisStore) Flush() error {
-	conn := c.pool.Get()
+func (c *RedisStore) Touch(key string, expires time.Duration) error {
+	conn, err := c.conn(context.Background())
+	if err != nil {
+		return err
+	}
 	defer conn.Close()
-	_, err := conn.Do("FLUSHALL")
-	return err
+	key = c.key(key)
+
+	expires = c.expires(expires)
+	if expires <= 0 {
+		// PERSIST also returns 0 when key has no ttl
+		if persisted, err := redis.Bool(conn.Do("PERSIST", key)); err != nil || persisted {
+			return err
+		}
+		if found, err := exists(conn, key); err != nil {
+			return err
+		} else if !found {
+			return ErrCacheMiss
+		}
+		return nil
+	}
+
+	touched, err := redis.Bool(conn.Do("PEXPIRE", key, milliseconds(expires)))
+	if err != nil {
+		return err
+	}
+	if !touched {
+		return ErrCacheMiss
+	}
+	return nil
 }
 
-func (c *RedisStore) invoke(f func(string, ...interface{}) (interface{}, error),
-	key string, value interface{}, expires time.Duration) error {
+//Flush deletes keys according to RedisOptions.FlushMode
+func (c *RedisStore) Flush() error {
+	return c.FlushContext(context.Background())
+}
+
+//FlushContext see Flush
+func (c *RedisStore) FlushContext(ctx context.Context) error {
+	if c.flushMode == RedisFlushPrefix && c.prefix == "" {
+		return ErrNotSupport
+	}
+
+	return c.nodes(ctx, false, func(node redis.Conn) error {
+		switch c.flushMode {
+		case RedisFlushDB:
+			_, err := node.Do("FLUSHDB")
+			return err
+		case RedisFlushAll:
+			_, err := node.Do("FLUSHALL")
+			return err
+		}
+
+		// UNLINK frees memory in background, the keys of a node are split by slot in cluster mode
+		conn := node
+		if c.cluster != nil {
+			conn = &clusterConn{cluster: c.cluster, ctx: ctx}
+		}
+		return c.scan(node, c.prefix, func(keys []string) (bool, error) {
+			_, err := conn.Do("UNLINK", redis.Args{}.AddFlat(keys)...)
+			return err == nil, err
+		})
+	})
+}
+
+//Scan calls fn for every key starting with prefix, keys are listed with SCAN and may be returned more than once
+func (c *RedisStore) Scan(prefix string, fn func(key string) bool) error {
+	next := true
+	return c.nodes(context.Background(), true, func(node redis.Conn) error {
+		if !next {
+			return nil
+		}
+		return c.scan(node, c.prefix+prefix, func(keys []string) (bool, error) {
+			for _, key := range keys {
+				if next = fn(strings.TrimPrefix(key, c.prefix)); !next {
+					return false, nil
+				}
+			}
+			return true, nil
+		})
+	})
+}
+
+// nodes calls fn with a connection to every node holding keys, every master in cluster mode. A replica is used for
+// reads if there are some.
+func (c *RedisStore) nodes(ctx context.Context, read bool, fn func(conn redis.Conn) error) error {
+	if c.cluster == nil {
+		connect := c.conn
+		if read {
+			connect = c.readConn
+		}
+		conn, err := connect(ctx)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		return fn(conn)
+	}
 
+	masters, err := c.cluster.masters()
+	if err != nil {
+		return err
+	}
+	for _, addr := range masters {
+		conn, err := getConn(ctx, c.cluster.pool(addr))
+		if err != nil {
+			return err
+		}
+		err = fn(contextConn{conn, ctx})
+		_ = conn.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scan calls fn with the keys starting with prefix by batch of flushBatchSize until fn returns false
+// SCAN doesn't block the server like KEYS
+func (c *RedisStore) scan(conn redis.Conn, prefix string, fn func(keys []string) (bool, error)) error {
+	cursor := "0"
+	for {
+		values, err := redis.Values(conn.Do("SCAN", cursor, "MATCH", escapeGlob(prefix)+"*", "COUNT", c.flushBatchSize))
+		if err != nil {
+			return err
+		}
+		if cursor, err = redis.String(values[0], nil); err != nil {
+			return err
+		}
+		keys, err := redis.Strings(values[1], nil)
+		if err != nil {
+			return err
+		}
+
+		if len(keys) > 0 {
+			if next, err := fn(keys); err != nil || !next {
+				return err
+			}
+		}
+		if cursor == "0" {
+			return nil
+		}
+	}
+}
+
+// escapeGlob escapes glob special characters of a MATCH pattern
+func escapeGlob(pattern string) string {
+	var buffer strings.Builder
+	for _, r := range pattern {
+		switch r {
+		case '*', '?', '[', ']', '\\':
+			buffer.WriteRune('\\')
+		}
+		buffer.WriteRune(r)
+	}
+	return buffer.String()
+}
+
+// expires resolve DEFAULT and NEVER, 0 means no expiration
+func (c *RedisStore) expires(expires time.Duration) time.Duration {
 	switch expires {
 	case DEFAULT:
-		expires = c.defaultExpiration
+		return c.defaultExpiration
 	case NEVER:
-		expires = time.Duration(0)
+		return time.Duration(0)
+	}
+	return expires
+}
+
+// milliseconds converts a ttl to the milliseconds of PX and PEXPIRE, rounded up so that a sub-millisecond ttl still
+// expires
+func milliseconds(expires time.Duration) int64 {
+	return int64((expires + time.Millisecond - 1) / time.Millisecond)
+}
+
+// invoke stores value with SET, condition is "NX" or "XX" if any. stored is false if SET did nothing because of
+// condition.
+func (c *RedisStore) invoke(f func(string, ...interface{}) (interface{}, error),
+	key string, value interface{}, expires time.Duration, condition ...interface{}) (stored bool, err error) {
+
+	expires = c.expires(expires)
+
+	if c.hashResponses {
+		switch response := value.(type) {
+		case ResponseCache:
+			return c.invokeResponse(f, key, response, expires, condition...)
+		case *ResponseCache:
+			return c.invokeResponse(f, key, *response, expires, condition...)
+		}
 	}
 
 	b, err := serialize(value)
 	if err != nil {
-		return err
+		return false, err
 	}
 
+	args := redis.Args{key, b}
 	if expires > 0 {
-		_, err := f("SETEX", key, int32(expires/time.Second), b)
-		return err
-	} else {
-		_, err := f("SET", key, b)
-		return err
+		args = append(args, "PX", milliseconds(expires))
 	}
+	reply, err := f("SET", append(args, condition...)...)
+	return reply != nil, err
 }
@@ -0,0 +1,453 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+const (
+	// redisClusterSlots number of hash slots of a Redis Cluster
+	redisClusterSlots = 16384
+	// redisClusterRedirects max MOVED / ASK redirections followed by a command
+	redisClusterRedirects = 5
+)
+
+// redisCluster slot map and connection pools of the nodes of a Redis Cluster
+type redisCluster struct {
+	options RedisOptions
+	seeds   []string
+
+	// mu guards pools and slots
+	mu    sync.RWMutex
+	pools map[string]*redis.Pool
+	slots [redisClusterSlots]string
+
+	// refreshMu serializes the refreshes of the slot map
+	refreshMu  sync.Mutex
+	refreshing int32
+}
+
+// clusterConn redis.Conn sending every command to the node of the slot of its keys. Multi-key commands are split
+// by slot, pipelined commands are sent one by one on Flush.
+type clusterConn struct {
+	cluster *redisCluster
+	ctx     context.Context
+
+	pending []clusterCommand
+	replies []clusterReply
+}
+
+type clusterCommand struct {
+	name string
+	args []interface{}
+}
+
+type clusterReply struct {
+	reply interface{}
+	err   error
+}
+
+func newRedisCluster(seeds []string, options RedisOptions) *redisCluster {
+	return &redisCluster{options: options, seeds: seeds, pools: map[string]*redis.Pool{}}
+}
+
+// pool returns the pool of the node addr, creating it if needed
+func (c *redisCluster) pool(addr string) *redis.Pool {
+	c.mu.RLock()
+	pool, found := c.pools[addr]
+	c.mu.RUnlock()
+	if found {
+		return pool
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if pool, found := c.pools[addr]; found {
+		return pool
+	}
+	pool = newRedisPool(c.options, func() (redis.Conn, error) {
+		return dialRedis("tcp", addr, c.options)
+	})
+	c.pools[addr] = pool
+	return pool
+}
+
+// close closes the pools of every node
+func (c *redisCluster) close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, pool := range c.pools {
+		_ = pool.Close()
+	}
+}
+
+// addr returns the master of slot, any node if slot is -1
+func (c *redisCluster) addr(slot int) (string, error) {
+	if slot < 0 {
+		masters, err := c.masters()
+		if err != nil {
+			return "", err
+		}
+		return masters[0], nil
+	}
+
+	c.mu.RLock()
+	addr := c.slots[slot]
+	c.mu.RUnlock()
+	if addr != "" {
+		return addr, nil
+	}
+
+	if err := c.refresh(); err != nil {
+		return "", err
+	}
+	c.mu.RLock()
+	addr = c.slots[slot]
+	c.mu.RUnlock()
+	if addr == "" {
+		return "", fmt.Errorf("cache: no redis cluster node serves slot %d", slot)
+	}
+	return addr, nil
+}
+
+// masters returns the nodes serving slots sorted by address
+func (c *redisCluster) masters() ([]string, error) {
+	masters := c.nodes()
+	if len(masters) == 0 {
+		if err := c.refresh(); err != nil {
+			return nil, err
+		}
+		masters = c.nodes()
+	}
+	if len(masters) == 0 {
+		return nil, errors.New("cache: no redis cluster node")
+	}
+	return masters, nil
+}
+
+func (c *redisCluster) nodes() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	found := map[string]bool{}
+	var nodes []string
+	for _, addr := range c.slots {
+		if addr != "" && !found[addr] {
+			found[addr] = true
+			nodes = append(nodes, addr)
+		}
+	}
+	sort.Strings(nodes)
+	return nodes
+}
+
+// refresh loads the slot map with CLUSTER SLOTS from the first node answering
+func (c *redisCluster) refresh() error {
+	c.refreshMu.Lock()
+	defer c.refreshMu.Unlock()
+
+	addrs := append([]string{}, c.seeds...)
+	addrs = append(addrs, c.nodes()...)
+
+	err := errors.New("cache: no redis cluster seed")
+	for _, addr := range addrs {
+		var slots [redisClusterSlots]string
+		if slots, err = c.clusterSlots(addr); err == nil {
+			c.mu.Lock()
+			c.slots = slots
+			c.mu.Unlock()
+			return nil
+		}
+	}
+	return err
+}
+
+// refreshAsync refreshes the slot map in background, at most one at a time
+func (c *redisCluster) refreshAsync() {
+	if !atomic.CompareAndSwapInt32(&c.refreshing, 0, 1) {
+		return
+	}
+	go func() {
+		defer atomic.StoreInt32(&c.refreshing, 0)
+		_ = c.refresh()
+	}()
+}
+
+func (c *redisCluster) clusterSlots(addr string) ([redisClusterSlots]string, error) {
+	var slots [redisClusterSlots]string
+
+	conn := c.pool(addr).Get()
+	defer conn.Close()
+	ranges, err := redis.Values(conn.Do("CLUSTER", "SLOTS"))
+	if err != nil {
+		return slots, err
+	}
+
+	for _, r := range ranges {
+		// start, end, master [host, port, id], replicas...
+		values, err := redis.Values(r, nil)
+		if err != nil || len(values) < 3 {
+			return slots, fmt.Errorf("cache: invalid CLUSTER SLOTS reply from %s", addr)
+		}
+		start, err1 := redis.Int(values[0], nil)
+		end, err2 := redis.Int(values[1], nil)
+		master, err3 := redis.Values(values[2], nil)
+		if err1 != nil || err2 != nil || err3 != nil || len(master) < 2 || start < 0 || end >= redisClusterSlots {
+			return slots, fmt.Errorf("cache: invalid CLUSTER SLOTS reply from %s", addr)
+		}
+		host, _ := redis.String(master[0], nil)
+		port, _ := redis.Int(master[1], nil)
+		if host == "" {
+			// The node doesn't know its own address
+			host, _, _ = net.SplitHostPort(addr)
+		}
+
+		node := net.JoinHostPort(host, strconv.Itoa(port))
+		for slot := start; slot <= end; slot++ {
+			slots[slot] = node
+		}
+	}
+	return slots, nil
+}
+
+// do runs a command on the node of slot, following MOVED and ASK redirections
+func (c *redisCluster) do(ctx context.Context, slot int, commandName string, args ...interface{}) (interface{}, error) {
+	addr, err := c.addr(slot)
+	if err != nil {
+		return nil, err
+	}
+
+	asking := false
+	for redirects := 0; ; redirects++ {
+		reply, err := c.doOn(ctx, addr, asking, commandName, args...)
+		if err == nil {
+			return reply, nil
+		}
+
+		redisErr, ok := err.(redis.Error)
+		if !ok {
+			if _, ok := err.(net.Error); ok {
+				// The node may be down, look for its replacement
+				c.refreshAsync()
+			}
+			return nil, err
+		}
+		if redirects == redisClusterRedirects {
+			return nil, err
+		}
+
+		// MOVED <slot> <addr> or ASK <slot> <addr>
+		fields := strings.Fields(string(redisErr))
+		if len(fields) != 3 || (fields[0] != "MOVED" && fields[0] != "ASK") {
+			return reply, err
+		}
+		addr, asking = fields[2], fields[0] == "ASK"
+		if !asking {
+			if movedSlot, err := strconv.Atoi(fields[1]); err == nil && movedSlot >= 0 && movedSlot < redisClusterSlots {
+				c.mu.Lock()
+				c.slots[movedSlot] = addr
+				c.mu.Unlock()
+			}
+			// Other slots probably moved too
+			c.refreshAsync()
+		}
+	}
+}
+
+func (c *redisCluster) doOn(ctx context.Context, addr string, asking bool, commandName string, args ...interface{}) (interface{}, error) {
+	pooled, err := getConn(ctx, c.pool(addr))
+	if err != nil {
+		return nil, err
+	}
+	defer pooled.Close()
+
+	conn := contextConn{pooled, ctx}
+	if asking {
+		if _, err := conn.Do("ASKING"); err != nil {
+			return nil, err
+		}
+	}
+	return conn.Do(commandName, args...)
+}
+
+func (c *clusterConn) Close() error {
+	c.pending, c.replies = nil, nil
+	return nil
+}
+
+func (c *clusterConn) Err() error {
+	return nil
+}
+
+func (c *clusterConn) Do(commandName string, args ...interface{}) (interface{}, error) {
+	switch strings.ToUpper(commandName) {
+	case "":
+		// Flush the pipeline and return the last reply like redis.Conn
+		if err := c.Flush(); err != nil {
+			return nil, err
+		}
+		var reply clusterReply
+		for len(c.replies) > 0 {
+			reply, c.replies = c.replies[0], c.replies[1:]
+		}
+		return reply.reply, reply.err
+	case "MGET":
+		return c.mget(args)
+	case "DEL", "UNLINK", "EXISTS":
+		return c.count(commandName, args)
+	case "SCRIPT":
+		// Every node has its own script cache, EVALSHA may be sent to any of them
+		return c.everyMaster(commandName, args)
+	}
+	return c.cluster.do(c.ctx, commandSlot(commandName, args), commandName, args...)
+}
+
+func (c *clusterConn) Send(commandName string, args ...interface{}) error {
+	c.pending = append(c.pending, clusterCommand{commandName, args})
+	return nil
+}
+
+func (c *clusterConn) Flush() error {
+	pending := c.pending
+	c.pending = nil
+	for _, command := range pending {
+		reply, err := c.Do(command.name, command.args...)
+		c.replies = append(c.replies, clusterReply{reply, err})
+	}
+	return nil
+}
+
+func (c *clusterConn) Receive() (interface{}, error) {
+	if len(c.replies) == 0 {
+		return nil, errors.New("cache: no pending redis cluster reply")
+	}
+	reply := c.replies[0]
+	c.replies = c.replies[1:]
+	return reply.reply, reply.err
+}
+
+// everyMaster runs a command on every master and returns the reply of the last one
+func (c *clusterConn) everyMaster(commandName string, args []interface{}) (interface{}, error) {
+	masters, err := c.cluster.masters()
+	if err != nil {
+		return nil, err
+	}
+	var reply interface{}
+	for _, addr := range masters {
+		if reply, err = c.cluster.doOn(c.ctx, addr, false, commandName, args...); err != nil {
+			return nil, err
+		}
+	}
+	return reply, nil
+}
+
+// mget runs a MGET by slot and merges their replies in the order of keys
+func (c *clusterConn) mget(keys []interface{}) (interface{}, error) {
+	replies := make([]interface{}, len(keys))
+	for slot, indexes := range slotIndexes(keys) {
+		args := make([]interface{}, len(indexes))
+		for i, index := range indexes {
+			args[i] = keys[index]
+		}
+		values, err := redis.Values(c.cluster.do(c.ctx, slot, "MGET", args...))
+		if err != nil {
+			return nil, err
+		}
+		for i, index := range indexes {
+			replies[index] = values[i]
+		}
+	}
+	return replies, nil
+}
+
+// count runs a multi-key command returning a number of keys by slot and sums their replies
+func (c *clusterConn) count(commandName string, keys []interface{}) (interface{}, error) {
+	var total int64
+	for slot, indexes := range slotIndexes(keys) {
+		args := make([]interface{}, len(indexes))
+		for i, index := range indexes {
+			args[i] = keys[index]
+		}
+		n, err := redis.Int64(c.cluster.do(c.ctx, slot, commandName, args...))
+		if err != nil {
+			return nil, err
+		}
+		total += n
+	}
+	return total, nil
+}
+
+// slotIndexes groups the indexes of keys by slot
+func slotIndexes(keys []interface{}) map[int][]int {
+	slots := map[int][]int{}
+	for i, key := range keys {
+		slot := hashSlot(argString(key))
+		slots[slot] = append(slots[slot], i)
+	}
+	return slots
+}
+
+// commandSlot returns the slot of the keys of a command, -1 for commands without keys
+func commandSlot(commandName string, args []interface{}) int {
+	switch strings.ToUpper(commandName) {
+	case "PING", "PUBLISH", "SCAN", "FLUSHDB", "FLUSHALL", "CLUSTER", "SCRIPT", "INFO":
+		return -1
+	case "EVAL", "EVALSHA":
+		// script, numkeys, keys...
+		if len(args) > 2 {
+			if numKeys, err := strconv.Atoi(argString(args[1])); err == nil && numKeys > 0 {
+				return hashSlot(argString(args[2]))
+			}
+		}
+		return -1
+	}
+	if len(args) == 0 {
+		return -1
+	}
+	return hashSlot(argString(args[0]))
+}
+
+func argString(arg interface{}) string {
+	switch arg := arg.(type) {
+	case string:
+		return arg
+	case []byte:
+		return string(arg)
+	}
+	return fmt.Sprint(arg)
+}
+
+// hashSlot returns the slot of key, only the hash tag between {} is hashed if there is one
+func hashSlot(key string) int {
+	if start := strings.IndexByte(key, '{'); start >= 0 {
+		if end := strings.IndexByte(key[start+1:], '}'); end > 0 {
+			key = key[start+1 : start+1+end]
+		}
+	}
+	return int(crc16(key) % redisClusterSlots)
+}
+
+// crc16 CRC16-CCITT (XMODEM) used by Redis Cluster
+func crc16(key string) uint16 {
+	var crc uint16
+	for i := 0; i < len(key); i++ {
+		crc ^= uint16(key[i]) << 8
+		for bit := 0; bit < 8; bit++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
@@ -0,0 +1,417 @@
+package cache
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeRedisCluster Redis Cluster stand-in: its nodes own ranges of slots and reply MOVED, ASK or CROSSSLOT like
+// cluster nodes, the other commands are forwarded to the redis server of the tests which holds the keys of every node.
+// Each node knows the scripts loaded or evaluated on it only, like the script cache of cluster nodes.
+type fakeRedisCluster struct {
+	backend *redis.Pool
+	nodes   []net.Listener
+
+	mu        sync.Mutex
+	owners    [redisClusterSlots]int
+	importing map[int]int
+	redirects int
+	scripts   map[int]map[string]bool
+}
+
+func newFakeRedisCluster(t *testing.T, nodes int) *fakeRedisCluster {
+	f := &fakeRedisCluster{
+		backend:   NewRedisCache(redisTestServer, "", DEFAULT).pool,
+		importing: map[int]int{},
+		scripts:   map[int]map[string]bool{},
+	}
+	for node := 0; node < nodes; node++ {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.nodes = append(f.nodes, listener)
+		go f.accept(node, listener)
+	}
+	for slot := range f.owners {
+		f.owners[slot] = slot * nodes / redisClusterSlots
+	}
+	return f
+}
+
+func (f *fakeRedisCluster) addr(node int) string {
+	return f.nodes[node].Addr().String()
+}
+
+func (f *fakeRedisCluster) close() {
+	for _, listener := range f.nodes {
+		_ = listener.Close()
+	}
+}
+
+// move gives slot to node without telling the clients, the old owner replies MOVED
+func (f *fakeRedisCluster) move(slot, node int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.owners[slot] = node
+}
+
+func (f *fakeRedisCluster) owner(slot int) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.owners[slot]
+}
+
+// migrate starts migrating slot to node, the owner replies ASK
+func (f *fakeRedisCluster) migrate(slot, node int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.importing[slot] = node
+}
+
+func (f *fakeRedisCluster) redirections() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.redirects
+}
+
+func (f *fakeRedisCluster) accept(node int, listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		go f.serve(node, conn)
+	}
+}
+
+func (f *fakeRedisCluster) serve(node int, conn net.Conn) {
+	defer conn.Close()
+	r, w := bufio.NewReader(conn), bufio.NewWriter(conn)
+
+	asking := false
+	for {
+		args, err := readFakeCommand(r)
+		if err != nil {
+			return
+		}
+		command := strings.ToUpper(args[0])
+		if command == "ASKING" {
+			asking = true
+			writeFakeReply(w, "OK")
+		} else {
+			writeFakeReply(w, f.do(node, asking, command, args[1:]))
+			asking = false
+		}
+		if w.Flush() != nil {
+			return
+		}
+	}
+}
+
+func (f *fakeRedisCluster) do(node int, asking bool, command string, args []string) interface{} {
+	f.mu.Lock()
+	if command == "CLUSTER" {
+		defer f.mu.Unlock()
+		return f.clusterSlots()
+	}
+
+	slot := -1
+	for _, key := range fakeCommandKeys(command, args) {
+		if keySlot := hashSlot(key); slot == -1 {
+			slot = keySlot
+		} else if keySlot != slot {
+			f.mu.Unlock()
+			return redis.Error("CROSSSLOT Keys in request don't hash to the same slot")
+		}
+	}
+	if slot != -1 {
+		if target, found := f.importing[slot]; found && f.owners[slot] == node {
+			f.redirects++
+			f.mu.Unlock()
+			return redis.Error("ASK " + strconv.Itoa(slot) + " " + f.addr(target))
+		}
+		if owner := f.owners[slot]; owner != node && !(asking && f.importing[slot] == node) {
+			f.redirects++
+			f.mu.Unlock()
+			return redis.Error("MOVED " + strconv.Itoa(slot) + " " + f.addr(owner))
+		}
+	}
+	if command == "EVALSHA" && !f.scripts[node][strings.ToLower(args[0])] {
+		f.mu.Unlock()
+		return redis.Error("NOSCRIPT No matching script. Please use EVAL.")
+	}
+	owners := f.owners
+	f.mu.Unlock()
+
+	conn := f.backend.Get()
+	defer conn.Close()
+	reply, err := conn.Do(command, redis.Args{}.AddFlat(args)...)
+	if err != nil {
+		return err
+	}
+	switch {
+	case command == "EVAL":
+		f.loaded(node, fmt.Sprintf("%x", sha1.Sum([]byte(args[0]))))
+	case command == "SCRIPT" && strings.ToUpper(args[0]) == "LOAD":
+		f.loaded(node, string(reply.([]byte)))
+	}
+	if command == "SCAN" {
+		// Only the keys of the node
+		values := reply.([]interface{})
+		var keys []interface{}
+		for _, key := range values[1].([]interface{}) {
+			if owners[hashSlot(string(key.([]byte)))] == node {
+				keys = append(keys, key)
+			}
+		}
+		reply = []interface{}{values[0], keys}
+	}
+	return reply
+}
+
+// loaded adds the script of hash to the script cache of node
+func (f *fakeRedisCluster) loaded(node int, hash string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.scripts[node] == nil {
+		f.scripts[node] = map[string]bool{}
+	}
+	f.scripts[node][strings.ToLower(hash)] = true
+}
+
+func (f *fakeRedisCluster) clusterSlots() interface{} {
+	var ranges []interface{}
+	start := 0
+	for slot := 1; slot <= redisClusterSlots; slot++ {
+		if slot < redisClusterSlots && f.owners[slot] == f.owners[start] {
+			continue
+		}
+		host, port, _ := net.SplitHostPort(f.addr(f.owners[start]))
+		portNumber, _ := strconv.Atoi(port)
+		ranges = append(ranges, []interface{}{int64(start), int64(slot - 1), []interface{}{[]byte(host), int64(portNumber)}})
+		start = slot
+	}
+	return ranges
+}
+
+func fakeCommandKeys(command string, args []string) []string {
+	switch command {
+	case "PING", "SCAN", "FLUSHDB", "FLUSHALL", "SCRIPT", "INFO", "PUBLISH":
+		return nil
+	case "MGET", "DEL", "UNLINK", "EXISTS":
+		return args
+	case "EVAL", "EVALSHA":
+		numKeys, _ := strconv.Atoi(args[1])
+		return args[2 : 2+numKeys]
+	}
+	if len(args) == 0 {
+		return nil
+	}
+	return args[:1]
+}
+
+func readFakeCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(line, "*") {
+		return nil, errors.New("inline commands aren't supported")
+	}
+	count, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+	if err != nil || count <= 0 {
+		return nil, errors.New("invalid command")
+	}
+
+	args := make([]string, count)
+	for i := range args {
+		if line, err = r.ReadString('\n'); err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+		if err != nil {
+			return nil, err
+		}
+		data := make([]byte, size+2)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, err
+		}
+		args[i] = string(data[:size])
+	}
+	return args, nil
+}
+
+func writeFakeReply(w *bufio.Writer, reply interface{}) {
+	switch reply := reply.(type) {
+	case nil:
+		_, _ = w.WriteString("$-1\r\n")
+	case string:
+		_, _ = w.WriteString("+" + reply + "\r\n")
+	case error:
+		_, _ = w.WriteString("-" + reply.Error() + "\r\n")
+	case int64:
+		_, _ = w.WriteString(":" + strconv.FormatInt(reply, 10) + "\r\n")
+	case []byte:
+		_, _ = w.WriteString("$" + strconv.Itoa(len(reply)) + "\r\n")
+		_, _ = w.Write(reply)
+		_, _ = w.WriteString("\r\n")
+	case []interface{}:
+		_, _ = w.WriteString("*" + strconv.Itoa(len(reply)) + "\r\n")
+		for _, value := range reply {
+			writeFakeReply(w, value)
+		}
+	}
+}
+
+var (
+	redisTestClusterOnce sync.Once
+	redisTestCluster     *fakeRedisCluster
+)
+
+var newRedisClusterStore = func(t *testing.T, defaultExpiration time.Duration) Store {
+	redisTestClusterOnce.Do(func() {
+		redisTestCluster = newFakeRedisCluster(t, 3)
+	})
+	redisCache := NewRedisCacheWithOptions(RedisOptions{
+		ClusterHosts:      []string{redisTestCluster.addr(0)},
+		DefaultExpiration: defaultExpiration,
+		Prefix:            "test:",
+	})
+	_ = redisCache.Flush()
+	return redisCache
+}
+
+func TestHashSlot(t *testing.T) {
+	assert.Equal(t, 12739, hashSlot("123456789"))
+	assert.Equal(t, 12182, hashSlot("foo"))
+	assert.Equal(t, hashSlot("user1000"), hashSlot("{user1000}.following"))
+	assert.NotEqual(t, hashSlot("following"), hashSlot("{}.following"))
+}
+
+func TestRedisClusterCache_TypicalGetSet(t *testing.T) {
+	typicalGetSet(t, newRedisClusterStore)
+}
+
+func TestRedisClusterCache_IncrDecr(t *testing.T) {
+	incrDecr(t, newRedisClusterStore)
+}
+
+func TestRedisClusterCache_Replace(t *testing.T) {
+	testReplace(t, newRedisClusterStore)
+}
+
+func TestRedisClusterCache_Add(t *testing.T) {
+	testAdd(t, newRedisClusterStore)
+}
+
+func TestRedisClusterCache_Batch(t *testing.T) {
+	testBatch(t, newRedisClusterStore)
+}
+
+func TestRedisClusterCache_CompareAndSwap(t *testing.T) {
+	testCAS(t, newRedisClusterStore)
+}
+
+func TestRedisClusterCache_TTL(t *testing.T) {
+	testTTL(t, newRedisClusterStore)
+}
+
+func TestRedisClusterCache_Context(t *testing.T) {
+	testContext(t, newRedisClusterStore)
+}
+
+func TestRedisClusterCache_Scan(t *testing.T) {
+	testScan(t, newRedisClusterStore)
+}
+
+func TestRedisClusterCache_Redirections(t *testing.T) {
+	cluster := newFakeRedisCluster(t, 3)
+	defer cluster.close()
+	redisCache := NewRedisCacheWithOptions(RedisOptions{
+		ClusterHosts: []string{cluster.addr(0)},
+		Prefix:       "test:",
+	})
+	assert.NoError(t, redisCache.Flush())
+
+	// Keys are spread over every node
+	values := map[string]interface{}{}
+	for i := 0; i < 30; i++ {
+		values["key"+strconv.Itoa(i)] = i
+	}
+	assert.NoError(t, SetMulti(redisCache, values, DEFAULT))
+	assert.Equal(t, 3, len(redisCache.cluster.nodes()))
+	assert.Equal(t, 0, cluster.redirections())
+
+	// MOVED updates the slot map
+	var get int
+	slot := hashSlot("test:key1")
+	cluster.move(slot, (cluster.owner(slot)+1)%3)
+	assert.NoError(t, redisCache.Get("key1", &get))
+	assert.Equal(t, 1, get)
+	assert.Equal(t, 1, cluster.redirections())
+	assert.NoError(t, redisCache.Get("key1", &get))
+	assert.Equal(t, 1, cluster.redirections())
+
+	// ASK doesn't
+	slot = hashSlot("test:key2")
+	cluster.migrate(slot, (cluster.owner(slot)+1)%3)
+	assert.NoError(t, redisCache.Get("key2", &get))
+	assert.Equal(t, 2, get)
+	assert.NoError(t, redisCache.Get("key2", &get))
+	assert.Equal(t, 3, cluster.redirections())
+
+	// Multi-key commands are split by slot
+	for key := range values {
+		values[key] = new(int)
+	}
+	assert.NoError(t, GetMulti(redisCache, values))
+	assert.Len(t, values, 30)
+	assert.Equal(t, 5, *values["key5"].(*int))
+	assert.NoError(t, DeleteMulti(redisCache, "key3", "key4", "key5"))
+	assert.Equal(t, ErrCacheMiss, redisCache.Get("key4", &get))
+
+	purged, err := PurgePrefix(redisCache, "key")
+	assert.NoError(t, err)
+	assert.Equal(t, 27, purged)
+}
+
+func TestRedisClusterCache_HashResponses(t *testing.T) {
+	cluster := newFakeRedisCluster(t, 3)
+	defer cluster.close()
+	redisCache := NewRedisCacheWithOptions(RedisOptions{
+		ClusterHosts:  []string{cluster.addr(0)},
+		Prefix:        "test:",
+		HashResponses: true,
+	})
+	defer redisCache.Close()
+	assert.NoError(t, redisCache.Flush())
+
+	// The script is loaded on every node before the pipeline
+	values := map[string]interface{}{}
+	for i := 0; i < 30; i++ {
+		values["response"+strconv.Itoa(i)] = ResponseCache{Status: http.StatusOK, Data: []byte(strconv.Itoa(i))}
+	}
+	assert.NoError(t, SetMulti(redisCache, values, DEFAULT))
+
+	for key := range values {
+		values[key] = &ResponseCache{}
+	}
+	assert.NoError(t, GetMulti(redisCache, values))
+	assert.Len(t, values, 30)
+	assert.Equal(t, []byte("5"), values["response5"].(*ResponseCache).Data)
+	assert.Equal(t, 3, len(redisCache.cluster.nodes()))
+}
@@ -0,0 +1,74 @@
+package cache
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+//RedisBalancing defines how RedisStore chooses the replica of a read
+type RedisBalancing int
+
+const (
+	//RedisRoundRobin sends the reads to every replica in turn
+	RedisRoundRobin RedisBalancing = iota
+	//RedisLeastLoaded sends a read to the replica with the fewest connections in use
+	RedisLeastLoaded
+)
+
+// redisReplicas pools of the replicas serving the reads of a RedisStore
+type redisReplicas struct {
+	pools     []*redis.Pool
+	balancing RedisBalancing
+	next      uint32
+}
+
+// readYourWritesKey context key of the flag set by WithReadYourWrites
+type readYourWritesKey struct{}
+
+//WithReadYourWrites returns a copy of ctx under which the reads of a RedisStore go to the primary once a command was
+// sent to it with ctx, so they see the writes done with ctx despite the replication lag. Use one by request, see
+// StoreMiddlewareConfig.ReadYourWrites.
+func WithReadYourWrites(ctx context.Context) context.Context {
+	return context.WithValue(ctx, readYourWritesKey{}, new(int32))
+}
+
+// wrote marks ctx of WithReadYourWrites as having sent a command to the primary
+func wrote(ctx context.Context) {
+	if written, ok := ctx.Value(readYourWritesKey{}).(*int32); ok {
+		atomic.StoreInt32(written, 1)
+	}
+}
+
+// readsPrimary returns true if ctx of WithReadYourWrites sent a command to the primary
+func readsPrimary(ctx context.Context) bool {
+	written, ok := ctx.Value(readYourWritesKey{}).(*int32)
+	return ok && atomic.LoadInt32(written) == 1
+}
+
+// pool returns the pool of the replica of the next read
+func (r *redisReplicas) pool() *redis.Pool {
+	// The modulo is taken on the uint32, int may be 32-bit
+	next := int(atomic.AddUint32(&r.next, 1) % uint32(len(r.pools)))
+	if r.balancing != RedisLeastLoaded {
+		return r.pools[next]
+	}
+
+	// Ties are broken in turn
+	var best *redis.Pool
+	bestLoad := 0
+	for i := range r.pools {
+		pool := r.pools[(next+i)%len(r.pools)]
+		if load := pool.ActiveCount() - pool.IdleCount(); best == nil || load < bestLoad {
+			best, bestLoad = pool, load
+		}
+	}
+	return best
+}
+
+func (r *redisReplicas) close() {
+	for _, pool := range r.pools {
+		_ = pool.Close()
+	}
+}
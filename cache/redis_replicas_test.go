@@ -0,0 +1,85 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedisCache_Replicas(t *testing.T) {
+	primary, replica1, replica2 := newFakeRedisNode(t, true), newFakeRedisNode(t, false), newFakeRedisNode(t, false)
+	defer primary.listener.Close()
+	defer replica1.listener.Close()
+	defer replica2.listener.Close()
+
+	newStore := func(balancing RedisBalancing, replicas ...string) *RedisStore {
+		redisCache := NewRedisCacheWithOptions(RedisOptions{
+			Host:             primary.addr(),
+			ReplicaHosts:     replicas,
+			ReplicaBalancing: balancing,
+			Prefix:           "test:",
+		})
+		return redisCache
+	}
+	redisCache := newStore(RedisRoundRobin, replica1.addr(), replica2.addr())
+	defer redisCache.Close()
+	assert.NoError(t, redisCache.Flush())
+
+	// Writes go to the primary, reads to the replicas in turn
+	var get int
+	assert.NoError(t, redisCache.Set("int", 1, DEFAULT))
+	writes, reads1, reads2 := primary.count(), replica1.count(), replica2.count()
+	for i := 0; i < 4; i++ {
+		assert.NoError(t, redisCache.Get("int", &get))
+		assert.Equal(t, 1, get)
+	}
+	assert.Equal(t, reads1+2, replica1.count())
+	assert.Equal(t, reads2+2, replica2.count())
+	_, err := redisCache.TTL("int")
+	assert.NoError(t, err)
+	assert.NoError(t, GetMulti(redisCache, map[string]interface{}{"int": &get}))
+	assert.NoError(t, redisCache.Scan("", func(string) bool { return true }))
+	assert.Equal(t, writes, primary.count())
+
+	// Read your writes
+	ctx := WithReadYourWrites(context.Background())
+	reads1, reads2 = replica1.count(), replica2.count()
+	assert.NoError(t, redisCache.GetContext(ctx, "int", &get))
+	assert.Equal(t, reads1+reads2+1, replica1.count()+replica2.count())
+	assert.NoError(t, redisCache.SetContext(ctx, "int", 2, DEFAULT))
+	assert.NoError(t, redisCache.GetContext(ctx, "int", &get))
+	assert.Equal(t, 2, get)
+	assert.Equal(t, reads1+reads2+1, replica1.count()+replica2.count())
+
+	// Least loaded
+	leastLoaded := newStore(RedisLeastLoaded, replica1.addr(), replica2.addr())
+	defer leastLoaded.Close()
+	busy := leastLoaded.replicas.pools[0].Get()
+	reads1, reads2 = replica1.count(), replica2.count()
+	for i := 0; i < 4; i++ {
+		assert.NoError(t, leastLoaded.Get("int", &get))
+	}
+	assert.NoError(t, busy.Close())
+	assert.Equal(t, reads1, replica1.count())
+	assert.Equal(t, reads2+4, replica2.count())
+
+	// Replica down
+	down := newStore(RedisRoundRobin, "127.0.0.1:1")
+	defer down.Close()
+	writes = primary.count()
+	assert.NoError(t, down.Get("int", &get))
+	assert.Equal(t, 2, get)
+	assert.Equal(t, writes+1, primary.count())
+}
+
+func TestRedisCache_ReplicasTimeout(t *testing.T) {
+	redisCache := NewRedisCacheWithOptions(RedisOptions{Host: redisTestServer, ReplicaHosts: []string{"127.0.0.1:1"}})
+	defer redisCache.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), -time.Second)
+	defer cancel()
+	var get int
+	assert.Equal(t, context.DeadlineExceeded, redisCache.GetContext(ctx, "int", &get))
+}
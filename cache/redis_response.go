@@ -0,0 +1,110 @@
+package cache
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// setResponseScript stores a response in the hash KEYS[1] with the fields meta ARGV[2], header ARGV[3] and body
+// ARGV[4], and a ttl of ARGV[1] milliseconds (0 for none). ARGV[5] is the condition of SET if any, "NX" or "XX".
+// Returns false if the condition prevented it.
+var setResponseScript = redis.NewScript(1, setResponseSource)
+
+// setResponseSource source of setResponseScript, sent with EVAL when the server doesn't know its sha1 yet
+const setResponseSource = `
+local exists = redis.call('EXISTS', KEYS[1]) == 1
+if (ARGV[5] == 'NX' and exists) or (ARGV[5] == 'XX' and not exists) then
+	return false
+end
+redis.call('DEL', KEYS[1])
+redis.call('HMSET', KEYS[1], 'meta', ARGV[2], 'header', ARGV[3], 'body', ARGV[4])
+if tonumber(ARGV[1]) > 0 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[1])
+end
+return 1
+`
+
+//GetResponseMeta reads the meta and header fields of a response stored with RedisOptions.HashResponses, Data is nil.
+// Returns ErrNotSupport if HashResponses isn't set or the response was stored before it was.
+func (c *RedisStore) GetResponseMeta(ctx context.Context, key string, cache *ResponseCache) error {
+	if !c.hashResponses {
+		return ErrNotSupport
+	}
+
+	conn, err := c.readConn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return c.getResponse(conn, key, cache, false)
+}
+
+// getResponse reads a response stored as a hash, with its body if body is set. Returns ErrNotSupport if key isn't a
+// hash.
+func (c *RedisStore) getResponse(conn redis.Conn, key string, cache *ResponseCache, body bool) error {
+	args := redis.Args{c.key(key), "meta", "header"}
+	if body {
+		args = append(args, "body")
+	}
+	fields, err := redis.Values(conn.Do("HMGET", args...))
+	if redisErr, ok := err.(redis.Error); ok && strings.HasPrefix(string(redisErr), "WRONGTYPE") {
+		return ErrNotSupport
+	}
+	if err != nil {
+		return err
+	}
+	if fields[0] == nil {
+		return ErrCacheMiss
+	}
+
+	meta, err := redis.Bytes(fields[0], nil)
+	if err != nil {
+		return err
+	}
+	*cache = ResponseCache{}
+	if err := deserialize(meta, cache); err != nil {
+		return err
+	}
+	if header, err := redis.Bytes(fields[1], nil); err == nil {
+		if err := deserialize(header, &cache.Header); err != nil {
+			return err
+		}
+	}
+	if body {
+		cache.Data, _ = redis.Bytes(fields[2], nil)
+	}
+	return nil
+}
+
+// invokeResponse stores response as a hash with setResponseScript, like invoke
+func (c *RedisStore) invokeResponse(f func(string, ...interface{}) (interface{}, error),
+	key string, response ResponseCache, expires time.Duration, condition ...interface{}) (stored bool, err error) {
+
+	header := response.Header
+	if header == nil {
+		header = http.Header{}
+	}
+	headerBytes, err := serialize(header)
+	if err != nil {
+		return false, err
+	}
+
+	body := response.Data
+	response.Header, response.Data, response.Size = nil, nil, len(body)
+	meta, err := serialize(response)
+	if err != nil {
+		return false, err
+	}
+
+	args := redis.Args{1, key, milliseconds(expires), meta, headerBytes, body}.Add(condition...)
+	reply, err := f("EVALSHA", append(redis.Args{setResponseScript.Hash()}, args...)...)
+	if redisErr, ok := err.(redis.Error); ok && strings.HasPrefix(string(redisErr), "NOSCRIPT") {
+		// Like redis.Script.Do, pipelines load the script first
+		reply, err = f("EVAL", append(redis.Args{setResponseSource}, args...)...)
+	}
+	return reply != nil, err
+}
@@ -0,0 +1,339 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+const (
+	// redisSentinelTimeout connect, read and write timeout of the connections to the sentinels
+	redisSentinelTimeout = time.Second
+	// redisSwitchMasterChannel channel of the failover events of the sentinels
+	redisSwitchMasterChannel = "+switch-master"
+)
+
+// errRedisMasterChanged returned by TestOnBorrow for the connections to a former master
+var errRedisMasterChanged = errors.New("cache: redis master changed")
+
+// redisSentinel resolves the master and the replicas of options.SentinelMaster with the sentinels. The master is
+// resolved again when it can't be dialed, replies READONLY or a +switch-master event is received.
+type redisSentinel struct {
+	options RedisOptions
+
+	// mu guards every field below
+	mu        sync.RWMutex
+	sentinels []string
+	master    string
+	replicas  []string
+	pubsub    redis.Conn
+	closed    bool
+
+	next uint32
+}
+
+// sentinelConn connection dialed by a redisSentinel, remembers its node
+type sentinelConn struct {
+	redis.Conn
+	sentinel *redisSentinel
+	addr     string
+	master   bool
+}
+
+func newRedisSentinel(options RedisOptions) *redisSentinel {
+	s := &redisSentinel{options: options, sentinels: append([]string{}, options.SentinelHosts...)}
+	go s.watch()
+	return s
+}
+
+// sentinelDo runs a command on the first sentinel answering, it is asked first next time
+func (s *redisSentinel) sentinelDo(commandName string, args ...interface{}) (interface{}, error) {
+	s.mu.RLock()
+	sentinels := append([]string{}, s.sentinels...)
+	s.mu.RUnlock()
+
+	err := errors.New("cache: no redis sentinel")
+	for i, addr := range sentinels {
+		var conn redis.Conn
+		if conn, err = s.dialSentinel(addr); err != nil {
+			continue
+		}
+		var reply interface{}
+		reply, err = conn.Do(commandName, args...)
+		_ = conn.Close()
+		if _, failed := err.(redis.Error); err == nil || failed {
+			if i > 0 {
+				s.mu.Lock()
+				s.sentinels = append([]string{addr}, append(sentinels[:i:i], sentinels[i+1:]...)...)
+				s.mu.Unlock()
+			}
+			return reply, err
+		}
+	}
+	return nil, err
+}
+
+func (s *redisSentinel) dialSentinel(addr string) (redis.Conn, error) {
+	conn, err := redis.Dial("tcp", addr,
+		redis.DialConnectTimeout(redisSentinelTimeout),
+		redis.DialReadTimeout(redisSentinelTimeout),
+		redis.DialWriteTimeout(redisSentinelTimeout),
+		redis.DialPassword(s.options.SentinelPassword),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return conn, nil
+}
+
+// resolve asks the sentinels the address of the master and of its replicas
+func (s *redisSentinel) resolve() (string, error) {
+	addr, err := redis.Strings(s.sentinelDo("SENTINEL", "get-master-addr-by-name", s.options.SentinelMaster))
+	if err == redis.ErrNil || (err == nil && len(addr) != 2) {
+		return "", fmt.Errorf("cache: redis sentinels don't know master %s", s.options.SentinelMaster)
+	}
+	if err != nil {
+		return "", err
+	}
+	master := net.JoinHostPort(addr[0], addr[1])
+
+	var replicas []string
+	if s.options.ReadFromReplicas {
+		// Reads fall back to the master
+		replicas, _ = s.resolveReplicas()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.master = master
+	s.replicas = replicas
+	return master, nil
+}
+
+// resolveReplicas returns the replicas of the master which are up
+func (s *redisSentinel) resolveReplicas() ([]string, error) {
+	values, err := redis.Values(s.sentinelDo("SENTINEL", "replicas", s.options.SentinelMaster))
+	if err != nil {
+		return nil, err
+	}
+
+	var replicas []string
+	for _, value := range values {
+		fields, err := redis.StringMap(value, nil)
+		if err != nil {
+			return nil, err
+		}
+		flags := fields["flags"]
+		if strings.Contains(flags, "s_down") || strings.Contains(flags, "o_down") || strings.Contains(flags, "disconnected") {
+			continue
+		}
+		replicas = append(replicas, net.JoinHostPort(fields["ip"], fields["port"]))
+	}
+	return replicas, nil
+}
+
+// invalidate forgets master, the next connections resolve it again
+func (s *redisSentinel) invalidate(master string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.master == master {
+		s.master = ""
+	}
+}
+
+// dialMaster connects to the master, asking the sentinels again if it doesn't answer or isn't a master anymore
+func (s *redisSentinel) dialMaster() (redis.Conn, error) {
+	s.mu.RLock()
+	addr := s.master
+	s.mu.RUnlock()
+
+	if addr != "" {
+		conn, err := s.dial(addr, true)
+		if err == nil {
+			return conn, nil
+		}
+		s.invalidate(addr)
+	}
+
+	addr, err := s.resolve()
+	if err != nil {
+		return nil, err
+	}
+	return s.dial(addr, true)
+}
+
+// dialReplica connects to the next replica answering, to the master if there is none
+func (s *redisSentinel) dialReplica() (redis.Conn, error) {
+	s.mu.RLock()
+	replicas := s.replicas
+	s.mu.RUnlock()
+	if len(replicas) == 0 {
+		return s.dialMaster()
+	}
+
+	// The modulo is taken on the uint32, int may be 32-bit
+	next := int(atomic.AddUint32(&s.next, 1) % uint32(len(replicas)))
+	for i := range replicas {
+		if conn, err := s.dial(replicas[(next+i)%len(replicas)], false); err == nil {
+			return conn, nil
+		}
+	}
+	return s.dialMaster()
+}
+
+// dial connects to addr and checks its ROLE
+func (s *redisSentinel) dial(addr string, master bool) (redis.Conn, error) {
+	conn, err := dialRedis("tcp", addr, s.options)
+	if err != nil {
+		return nil, err
+	}
+
+	role, err := redis.Values(conn.Do("ROLE"))
+	if err == nil && len(role) == 0 {
+		err = fmt.Errorf("cache: invalid ROLE reply from %s", addr)
+	}
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	if name, _ := redis.String(role[0], nil); (name == "master") != master {
+		_ = conn.Close()
+		return nil, fmt.Errorf("cache: redis %s is a %s", addr, name)
+	}
+	return &sentinelConn{Conn: conn, sentinel: s, addr: addr, master: master}, nil
+}
+
+// testOnBorrow discards the connections to a former master and checks the others like any pool
+func (s *redisSentinel) testOnBorrow(conn redis.Conn, t time.Time) error {
+	if c, ok := conn.(*sentinelConn); ok && c.master {
+		s.mu.RLock()
+		master := s.master
+		s.mu.RUnlock()
+		if c.addr != master {
+			return errRedisMasterChanged
+		}
+	}
+	return redisHealthCheck(s.options.HealthCheckInterval)(conn, t)
+}
+
+// watch follows the +switch-master events until close, missed events are caught up by resolving the master again
+func (s *redisSentinel) watch() {
+	for {
+		s.mu.RLock()
+		sentinels := append([]string{}, s.sentinels...)
+		s.mu.RUnlock()
+
+		for _, addr := range sentinels {
+			conn, err := redis.Dial("tcp", addr,
+				redis.DialConnectTimeout(redisSentinelTimeout),
+				redis.DialPassword(s.options.SentinelPassword),
+			)
+			if err != nil {
+				continue
+			}
+			if !s.receive(conn) {
+				return
+			}
+		}
+
+		s.mu.RLock()
+		closed := s.closed
+		s.mu.RUnlock()
+		if closed {
+			return
+		}
+		time.Sleep(redisResubscribeDelay)
+	}
+}
+
+// receive applies the +switch-master events received on conn until it breaks, false once closed
+func (s *redisSentinel) receive(conn redis.Conn) bool {
+	pubsub := redis.PubSubConn{Conn: conn}
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		_ = conn.Close()
+		return false
+	}
+	s.pubsub = conn
+	s.mu.Unlock()
+	defer pubsub.Close()
+
+	if err := pubsub.Subscribe(redisSwitchMasterChannel); err != nil {
+		return true
+	}
+	for {
+		switch message := pubsub.Receive().(type) {
+		case redis.Message:
+			// <master name> <old ip> <old port> <new ip> <new port>
+			fields := strings.Fields(string(message.Data))
+			if len(fields) == 5 && fields[0] == s.options.SentinelMaster {
+				s.switchMaster(net.JoinHostPort(fields[3], fields[4]))
+			}
+		case redis.Subscription:
+			// Events may have been missed while not subscribed
+			if message.Count > 0 {
+				_, _ = s.resolve()
+			}
+		case error:
+			s.mu.RLock()
+			closed := s.closed
+			s.mu.RUnlock()
+			return !closed
+		}
+	}
+}
+
+func (s *redisSentinel) switchMaster(master string) {
+	s.mu.Lock()
+	s.master = master
+	s.mu.Unlock()
+
+	if s.options.ReadFromReplicas {
+		if replicas, err := s.resolveReplicas(); err == nil {
+			s.mu.Lock()
+			s.replicas = replicas
+			s.mu.Unlock()
+		}
+	}
+}
+
+// close stops watching the sentinels
+func (s *redisSentinel) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	if s.pubsub != nil {
+		_ = s.pubsub.Close()
+	}
+}
+
+func (c *sentinelConn) Do(commandName string, args ...interface{}) (interface{}, error) {
+	return c.check(c.Conn.Do(commandName, args...))
+}
+
+func (c *sentinelConn) DoWithTimeout(timeout time.Duration, commandName string, args ...interface{}) (interface{}, error) {
+	return c.check(redis.DoWithTimeout(c.Conn, timeout, commandName, args...))
+}
+
+func (c *sentinelConn) Receive() (interface{}, error) {
+	return c.check(c.Conn.Receive())
+}
+
+func (c *sentinelConn) ReceiveWithTimeout(timeout time.Duration) (interface{}, error) {
+	return c.check(redis.ReceiveWithTimeout(c.Conn, timeout))
+}
+
+// check forgets the master when it replies READONLY, it was demoted without being noticed
+func (c *sentinelConn) check(reply interface{}, err error) (interface{}, error) {
+	if redisErr, ok := err.(redis.Error); ok && c.master && strings.HasPrefix(string(redisErr), "READONLY") {
+		c.sentinel.invalidate(c.addr)
+	}
+	return reply, err
+}
@@ -0,0 +1,290 @@
+package cache
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeRedisNode master or replica stand-in replying to ROLE, the other commands are forwarded to the redis server of
+// the tests. Replicas reply READONLY to writes.
+type fakeRedisNode struct {
+	backend  *redis.Pool
+	listener net.Listener
+
+	mu       sync.Mutex
+	master   bool
+	commands int
+}
+
+// fakeRedisSentinel sentinel stand-in monitoring a master and its replicas
+type fakeRedisSentinel struct {
+	name     string
+	listener net.Listener
+
+	mu          sync.Mutex
+	master      *fakeRedisNode
+	replicas    []*fakeRedisNode
+	subscribers []*bufio.Writer
+}
+
+// fakeNoReply returned by the handlers of serveFake which already replied
+type fakeNoReply struct{}
+
+// fakeReadCommands commands accepted by the replicas
+var fakeReadCommands = map[string]bool{"GET": true, "MGET": true, "PTTL": true, "EXISTS": true, "SCAN": true, "PING": true}
+
+func newFakeRedisNode(t *testing.T, master bool) *fakeRedisNode {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := &fakeRedisNode{backend: NewRedisCache(redisTestServer, "", DEFAULT).pool, listener: listener, master: master}
+	go serveFake(listener, n.do)
+	return n
+}
+
+func (n *fakeRedisNode) addr() string {
+	return n.listener.Addr().String()
+}
+
+func (n *fakeRedisNode) setMaster(master bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.master = master
+}
+
+// count number of commands received, ROLE and PING excepted
+func (n *fakeRedisNode) count() int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.commands
+}
+
+func (n *fakeRedisNode) do(_ *bufio.Writer, command string, args []string) interface{} {
+	n.mu.Lock()
+	master := n.master
+	if command != "ROLE" && command != "PING" {
+		n.commands++
+	}
+	n.mu.Unlock()
+
+	switch {
+	case command == "ROLE" && master:
+		return []interface{}{[]byte("master"), int64(0), []interface{}{}}
+	case command == "ROLE":
+		return []interface{}{[]byte("slave"), []byte("127.0.0.1"), int64(6379), []byte("connected"), int64(0)}
+	case !master && !fakeReadCommands[command]:
+		return redis.Error("READONLY You can't write against a read only replica.")
+	}
+
+	conn := n.backend.Get()
+	defer conn.Close()
+	reply, err := conn.Do(command, redis.Args{}.AddFlat(args)...)
+	if err != nil {
+		return err
+	}
+	return reply
+}
+
+func newFakeRedisSentinel(t *testing.T, name string, master *fakeRedisNode, replicas ...*fakeRedisNode) *fakeRedisSentinel {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeRedisSentinel{name: name, listener: listener, master: master, replicas: replicas}
+	go serveFake(listener, s.do)
+	return s
+}
+
+func (s *fakeRedisSentinel) addr() string {
+	return s.listener.Addr().String()
+}
+
+func (s *fakeRedisSentinel) subscribed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.subscribers) > 0
+}
+
+// failover promotes master and demotes replicas, the subscribers get a +switch-master event if publish is set
+func (s *fakeRedisSentinel) failover(master *fakeRedisNode, publish bool, replicas ...*fakeRedisNode) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	old := s.master
+	s.master, s.replicas = master, replicas
+	master.setMaster(true)
+	for _, replica := range replicas {
+		replica.setMaster(false)
+	}
+
+	if publish {
+		oldHost, oldPort, _ := net.SplitHostPort(old.addr())
+		host, port, _ := net.SplitHostPort(master.addr())
+		event := strings.Join([]string{s.name, oldHost, oldPort, host, port}, " ")
+		for _, w := range s.subscribers {
+			writeFakeReply(w, []interface{}{[]byte("message"), []byte(redisSwitchMasterChannel), []byte(event)})
+			_ = w.Flush()
+		}
+	}
+}
+
+func (s *fakeRedisSentinel) do(w *bufio.Writer, command string, args []string) interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch {
+	case command == "PING":
+		return "PONG"
+	case command == "SUBSCRIBE":
+		// Written under lock, failover writes to subscribers concurrently
+		writeFakeReply(w, []interface{}{[]byte("subscribe"), []byte(args[0]), int64(1)})
+		_ = w.Flush()
+		s.subscribers = append(s.subscribers, w)
+		return fakeNoReply{}
+	case command != "SENTINEL" || len(args) != 2:
+		return redis.Error("ERR unknown command")
+	case args[1] != s.name:
+		return nil
+	case strings.ToLower(args[0]) == "get-master-addr-by-name":
+		host, port, _ := net.SplitHostPort(s.master.addr())
+		return []interface{}{[]byte(host), []byte(port)}
+	case strings.ToLower(args[0]) == "replicas":
+		var replicas []interface{}
+		for _, replica := range s.replicas {
+			host, port, _ := net.SplitHostPort(replica.addr())
+			replicas = append(replicas, []interface{}{
+				[]byte("ip"), []byte(host), []byte("port"), []byte(port), []byte("flags"), []byte("slave"),
+			})
+		}
+		return replicas
+	}
+	return redis.Error("ERR unknown sentinel subcommand")
+}
+
+// serveFake replies to the commands received by listener with do until it is closed
+func serveFake(listener net.Listener, do func(w *bufio.Writer, command string, args []string) interface{}) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+			r, w := bufio.NewReader(conn), bufio.NewWriter(conn)
+			for {
+				args, err := readFakeCommand(r)
+				if err != nil {
+					return
+				}
+				reply := do(w, strings.ToUpper(args[0]), args[1:])
+				if _, replied := reply.(fakeNoReply); replied {
+					continue
+				}
+				writeFakeReply(w, reply)
+				if w.Flush() != nil {
+					return
+				}
+			}
+		}()
+	}
+}
+
+var (
+	redisTestSentinelOnce sync.Once
+	redisTestSentinel     *fakeRedisSentinel
+)
+
+var newRedisSentinelStore = func(t *testing.T, defaultExpiration time.Duration) Store {
+	redisTestSentinelOnce.Do(func() {
+		redisTestSentinel = newFakeRedisSentinel(t, "test", newFakeRedisNode(t, true), newFakeRedisNode(t, false))
+	})
+	redisCache := NewRedisCacheWithOptions(RedisOptions{
+		SentinelHosts:     []string{redisTestSentinel.addr()},
+		SentinelMaster:    "test",
+		ReadFromReplicas:  true,
+		DefaultExpiration: defaultExpiration,
+		Prefix:            "test:",
+	})
+	_ = redisCache.Flush()
+	return redisCache
+}
+
+func TestRedisSentinelCache_TypicalGetSet(t *testing.T) {
+	typicalGetSet(t, newRedisSentinelStore)
+}
+
+func TestRedisSentinelCache_IncrDecr(t *testing.T) {
+	incrDecr(t, newRedisSentinelStore)
+}
+
+func TestRedisSentinelCache_Batch(t *testing.T) {
+	testBatch(t, newRedisSentinelStore)
+}
+
+func TestRedisSentinelCache_CompareAndSwap(t *testing.T) {
+	testCAS(t, newRedisSentinelStore)
+}
+
+func TestRedisSentinelCache_Context(t *testing.T) {
+	testContext(t, newRedisSentinelStore)
+}
+
+func TestRedisSentinelCache_Failover(t *testing.T) {
+	a, b := newFakeRedisNode(t, true), newFakeRedisNode(t, false)
+	sentinel := newFakeRedisSentinel(t, "test", a, b)
+	defer a.listener.Close()
+	defer b.listener.Close()
+	defer sentinel.listener.Close()
+
+	// The first sentinel is down
+	redisCache := NewRedisCacheWithOptions(RedisOptions{
+		SentinelHosts:    []string{"127.0.0.1:1", sentinel.addr()},
+		SentinelMaster:   "test",
+		ReadFromReplicas: true,
+		Prefix:           "test:",
+	})
+	defer redisCache.Close()
+
+	// Writes go to the master, reads to the replica
+	var get int
+	assert.NoError(t, redisCache.Set("int", 1, DEFAULT))
+	writes := a.count()
+	assert.NoError(t, redisCache.Get("int", &get))
+	assert.Equal(t, 1, get)
+	assert.Equal(t, writes, a.count())
+	assert.True(t, b.count() > 0)
+
+	// +switch-master
+	deadline := time.Now().Add(2 * time.Second)
+	for !sentinel.subscribed() && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	sentinel.failover(b, true, a)
+	for time.Now().Before(deadline) {
+		redisCache.sentinel.mu.RLock()
+		master := redisCache.sentinel.master
+		redisCache.sentinel.mu.RUnlock()
+		if master == b.addr() {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	writes = b.count()
+	assert.NoError(t, redisCache.Set("int", 2, DEFAULT))
+	assert.Equal(t, writes+1, b.count())
+
+	// Missed failover, the former master replies READONLY once
+	sentinel.failover(a, false, b)
+	assert.Error(t, redisCache.Set("int", 3, DEFAULT))
+	assert.NoError(t, redisCache.Set("int", 3, DEFAULT))
+	assert.NoError(t, redisCache.Get("int", &get))
+	assert.Equal(t, 3, get)
+}
@@ -1,9 +1,17 @@
 package cache
 
 import (
+	"context"
 	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/stretchr/testify/assert"
 )
 
 // These tests require redis server running on localhost:6379 (the default)
@@ -14,7 +22,11 @@ var newRedisStore = func(t *testing.T, defaultExpiration time.Duration) Store {
 	if err == nil {
 		_, _ = c.Write([]byte("flush_all\r\n"))
 		_ = c.Close()
-		redisCache := NewRedisCache(redisTestServer, "", defaultExpiration)
+		redisCache := NewRedisCacheWithOptions(RedisOptions{
+			Host:              redisTestServer,
+			DefaultExpiration: defaultExpiration,
+			Prefix:            "test:",
+		})
 		_ = redisCache.Flush()
 		return redisCache
 	}
@@ -35,6 +47,10 @@ func TestRedisCache_Expiration(t *testing.T) {
 	expiration(t, newRedisStore)
 }
 
+func TestRedisCache_MillisecondExpiration(t *testing.T) {
+	millisecondExpiration(t, newRedisStore)
+}
+
 func TestRedisCache_EmptyCache(t *testing.T) {
 	emptyCache(t, newRedisStore)
 }
@@ -46,3 +62,227 @@ func TestRedisCache_Replace(t *testing.T) {
 func TestRedisCache_Add(t *testing.T) {
 	testAdd(t, newRedisStore)
 }
+
+func TestRedisCache_NamespaceFlush(t *testing.T) {
+	testNamespaceFlush(t, newRedisStore)
+}
+
+func TestRedisCache_FlushPrefix(t *testing.T) {
+	// Check the server is up and clean previous test keys
+	newRedisStore(t, time.Hour)
+	store1 := NewRedisCacheWithOptions(RedisOptions{Host: redisTestServer, Prefix: "test:1:", FlushBatchSize: 2})
+	store2 := NewRedisCacheWithOptions(RedisOptions{Host: redisTestServer, Prefix: "test:2:"})
+
+	for i := 0; i < 10; i++ {
+		assert.NoError(t, store1.Set(strconv.Itoa(i), i, time.Hour))
+		assert.NoError(t, store2.Set(strconv.Itoa(i), i, time.Hour))
+	}
+	assert.NoError(t, store1.Flush())
+
+	var get int
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, ErrCacheMiss, store1.Get(strconv.Itoa(i), &get))
+		assert.NoError(t, store2.Get(strconv.Itoa(i), &get))
+		assert.Equal(t, i, get)
+	}
+
+	// Flushing without prefix needs an explicit flush mode
+	assert.Equal(t, ErrNotSupport, NewRedisCache(redisTestServer, "", time.Hour).Flush())
+}
+
+func TestRedisCache_Batch(t *testing.T) {
+	testBatch(t, newRedisStore)
+}
+
+func TestRedisCache_CompareAndSwap(t *testing.T) {
+	testCAS(t, newRedisStore)
+}
+
+func TestRedisCache_TTL(t *testing.T) {
+	testTTL(t, newRedisStore)
+}
+
+func TestRedisCache_Context(t *testing.T) {
+	testContext(t, newRedisStore)
+}
+
+func TestRedisCache_ContextDeadline(t *testing.T) {
+	addr, stop := silentServer(t)
+	defer stop()
+	redisCache := NewRedisCacheWithOptions(RedisOptions{Host: addr, ReadTimeout: time.Minute})
+	defer redisCache.Close()
+	testDeadline(t, redisCache)
+}
+
+func TestRedisCache_Scan(t *testing.T) {
+	testScan(t, newRedisStore)
+}
+
+func TestRedisCache_Options(t *testing.T) {
+	newStore := func(db int) *RedisStore {
+		return NewRedisCacheWithOptions(RedisOptions{
+			Host:                redisTestServer,
+			DB:                  db,
+			Prefix:              "test:",
+			ConnectTimeout:      time.Second,
+			ReadTimeout:         time.Second,
+			WriteTimeout:        time.Second,
+			MaxActive:           1,
+			Wait:                true,
+			HealthCheckInterval: time.Minute,
+		})
+	}
+	store0, store1 := newStore(0), newStore(1)
+	assert.NoError(t, store0.Flush())
+	assert.NoError(t, store1.Flush())
+
+	// Databases are selected
+	var get int
+	assert.NoError(t, store1.Set("int", 1, DEFAULT))
+	assert.Equal(t, ErrCacheMiss, store0.Get("int", &get))
+	assert.NoError(t, store1.Get("int", &get))
+	assert.Equal(t, 1, get)
+
+	// Commands wait for the only connection
+	conn := store1.pool.Get()
+	released := make(chan struct{})
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		close(released)
+		_ = conn.Close()
+	}()
+	assert.NoError(t, store1.Get("int", &get))
+	select {
+	case <-released:
+	default:
+		t.Error("Get didn't wait for the connection")
+	}
+
+	// Invalid credentials
+	assert.Error(t, NewRedisCacheWithOptions(RedisOptions{Host: redisTestServer, Username: "user", Password: "password"}).Set("int", 1, DEFAULT))
+}
+
+func TestRedisCache_WithPool(t *testing.T) {
+	pool := NewRedisCache(redisTestServer, "", DEFAULT).pool
+	redisCache := NewRedisCacheWithPool(pool, RedisOptions{Prefix: "test:", DefaultExpiration: time.Hour})
+	assert.NoError(t, redisCache.Flush())
+
+	assert.NoError(t, redisCache.Set("int", 1, DEFAULT))
+	ttl, err := redisCache.TTL("int")
+	assert.NoError(t, err)
+	assert.True(t, ttl > 59*time.Minute, "ttl: %s", ttl)
+
+	assert.NoError(t, redisCache.Close())
+	assert.Error(t, redisCache.Set("int", 1, DEFAULT))
+}
+
+func TestRedisCache_Atomic(t *testing.T) {
+	redisCache := newRedisStore(t, time.Hour).(*RedisStore)
+
+	// Counters keep their ttl
+	assert.NoError(t, redisCache.Set("int", 10, time.Minute))
+	newValue, err := redisCache.Increment("int", 5)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(15), newValue)
+	newValue, err = redisCache.Decrement("int", 100)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(0), newValue)
+	ttl, err := redisCache.TTL("int")
+	assert.NoError(t, err)
+	assert.True(t, ttl > 59*time.Second && ttl <= time.Minute, "ttl: %s", ttl)
+
+	// Counters aren't created
+	_, err = redisCache.Increment("other", 1)
+	assert.Equal(t, ErrCacheMiss, err)
+	_, err = redisCache.Decrement("other", 1)
+	assert.Equal(t, ErrCacheMiss, err)
+	_, err = redisCache.TTL("other")
+	assert.Equal(t, ErrCacheMiss, err)
+
+	// Only one concurrent Add succeeds
+	var wg sync.WaitGroup
+	var added int32
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if redisCache.Add("add", i, DEFAULT) == nil {
+				atomic.AddInt32(&added, 1)
+			}
+		}(i)
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), added)
+}
+
+func TestRedisCache_HashResponses(t *testing.T) {
+	redisCache := NewRedisCacheWithOptions(RedisOptions{Host: redisTestServer, Prefix: "test:", HashResponses: true})
+	defer redisCache.Close()
+	assert.NoError(t, redisCache.Flush())
+
+	response := ResponseCache{
+		Status: http.StatusOK,
+		Header: http.Header{"Etag": {`"v1"`}},
+		Data:   []byte("body"),
+		URI:    "/api/v1/info",
+		Tags:   []string{"info"},
+	}
+	assert.NoError(t, redisCache.Set("response", response, time.Minute))
+	conn := redisCache.pool.Get()
+	kind, err := redis.String(conn.Do("TYPE", "test:response"))
+	_ = conn.Close()
+	assert.NoError(t, err)
+	assert.Equal(t, "hash", kind)
+
+	var cache ResponseCache
+	assert.NoError(t, redisCache.Get("response", &cache))
+	response.Size = 4
+	assert.Equal(t, response, cache)
+
+	// Without body
+	assert.NoError(t, redisCache.GetResponseMeta(context.Background(), "response", &cache))
+	assert.Nil(t, cache.Data)
+	assert.Equal(t, 4, cache.Size)
+	assert.Equal(t, response.Header, cache.Header)
+	assert.Equal(t, response.Tags, cache.Tags)
+	assert.Equal(t, ErrCacheMiss, redisCache.GetResponseMeta(context.Background(), "missing", &cache))
+
+	// Conditions and ttl
+	assert.Equal(t, ErrNotStored, redisCache.Add("response", response, time.Minute))
+	assert.Equal(t, ErrNotStored, redisCache.Replace("missing", &response, time.Minute))
+	response.Stale = true
+	assert.NoError(t, redisCache.Replace("response", &response, NEVER))
+	ttl, err := redisCache.TTL("response")
+	assert.NoError(t, err)
+	assert.Equal(t, NEVER, ttl)
+	assert.NoError(t, SoftPurge(redisCache, "response"))
+	assert.NoError(t, redisCache.Get("response", &cache))
+	assert.True(t, cache.Stale)
+
+	// Stored before HashResponses was set
+	stringCache := NewRedisCacheWithOptions(RedisOptions{Host: redisTestServer, Prefix: "test:"})
+	defer stringCache.Close()
+	assert.NoError(t, stringCache.Set("string", response, DEFAULT))
+	assert.Equal(t, ErrNotSupport, redisCache.GetResponseMeta(context.Background(), "string", &cache))
+	assert.NoError(t, GetResponseMeta(context.Background(), redisCache, "string", &cache))
+	assert.Equal(t, []byte("body"), cache.Data)
+	assert.Equal(t, 4, cache.Size)
+
+	// Sent with EVAL once the script is unknown
+	conn = redisCache.pool.Get()
+	_, err = conn.Do("SCRIPT", "FLUSH")
+	_ = conn.Close()
+	assert.NoError(t, err)
+	response.Stale = false
+	assert.NoError(t, redisCache.SetMulti(map[string]interface{}{"a": response, "b": &response}, time.Minute))
+	assert.NoError(t, redisCache.Set("response", response, time.Minute))
+
+	// Batch
+	a, b, missing := ResponseCache{}, ResponseCache{}, ResponseCache{}
+	values := map[string]interface{}{"a": &a, "b": &b, "string": &cache, "missing": &missing}
+	assert.NoError(t, redisCache.GetMulti(values))
+	assert.Len(t, values, 3)
+	assert.Equal(t, response, a)
+	assert.Equal(t, response, b)
+	assert.Equal(t, []byte("body"), cache.Data)
+}
@@ -0,0 +1,112 @@
+package cache
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//ParseRedisURL returns the RedisOptions of a redis://, rediss:// (TLS) or unix:// url:
+//
+//	redis://[[username]:password@]host[:port][/db][?option=value&...]
+//	rediss://[[username]:password@]host[:port][/db][?option=value&...]
+//	unix://[[username]:password@]/path/to/redis.sock[?db=db&option=value&...]
+//
+// A userinfo without colon is the password, like redis://password@host. The port defaults to 6379. Options are db, connect_timeout, read_timeout, write_timeout, max_idle, max_active,
+// wait, idle_timeout, max_conn_lifetime, health_check_interval, skip_verify (rediss) and prefix, durations are
+// parsed with time.ParseDuration.
+func ParseRedisURL(rawurl string) (RedisOptions, error) {
+	var options RedisOptions
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return options, err
+	}
+
+	switch u.Scheme {
+	case "redis", "rediss":
+		host, port := u.Hostname(), u.Port()
+		if port == "" {
+			port = "6379"
+		}
+		if host == "" {
+			host = "localhost"
+		}
+		options.Network = "tcp"
+		options.Host = net.JoinHostPort(host, port)
+
+		if db := strings.TrimPrefix(u.Path, "/"); db != "" {
+			if options.DB, err = strconv.Atoi(db); err != nil {
+				return options, fmt.Errorf("cache: invalid redis database %q", db)
+			}
+		}
+		if u.Scheme == "rediss" {
+			options.TLSConfig = &tls.Config{ServerName: host}
+		}
+	case "unix":
+		if u.Path == "" {
+			return options, fmt.Errorf("cache: missing redis socket path in %q", rawurl)
+		}
+		options.Network = "unix"
+		options.Host = u.Path
+	default:
+		return options, fmt.Errorf("cache: invalid redis url scheme %q", u.Scheme)
+	}
+
+	if u.User != nil {
+		if password, ok := u.User.Password(); ok {
+			options.Username, options.Password = u.User.Username(), password
+		} else {
+			options.Password = u.User.Username()
+		}
+	}
+
+	for name, values := range u.Query() {
+		if err := setRedisURLOption(&options, name, values[len(values)-1]); err != nil {
+			return options, err
+		}
+	}
+	return options, nil
+}
+
+func setRedisURLOption(options *RedisOptions, name string, value string) error {
+	var err error
+	switch name {
+	case "db":
+		options.DB, err = strconv.Atoi(value)
+	case "connect_timeout":
+		options.ConnectTimeout, err = time.ParseDuration(value)
+	case "read_timeout":
+		options.ReadTimeout, err = time.ParseDuration(value)
+	case "write_timeout":
+		options.WriteTimeout, err = time.ParseDuration(value)
+	case "max_idle":
+		options.MaxIdle, err = strconv.Atoi(value)
+	case "max_active":
+		options.MaxActive, err = strconv.Atoi(value)
+	case "wait":
+		options.Wait, err = strconv.ParseBool(value)
+	case "idle_timeout":
+		options.IdleTimeout, err = time.ParseDuration(value)
+	case "max_conn_lifetime":
+		options.MaxConnLifetime, err = time.ParseDuration(value)
+	case "health_check_interval":
+		options.HealthCheckInterval, err = time.ParseDuration(value)
+	case "skip_verify":
+		if options.TLSConfig == nil {
+			return fmt.Errorf("cache: redis url option %s needs rediss://", name)
+		}
+		options.TLSConfig.InsecureSkipVerify, err = strconv.ParseBool(value)
+	case "prefix":
+		options.Prefix = value
+	default:
+		return fmt.Errorf("cache: unknown redis url option %s", name)
+	}
+	if err != nil {
+		return fmt.Errorf("cache: invalid redis url option %s: %v", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package cache
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// GetResponseMeta gets the ResponseCache stored under key without its Data if store implements ResponseMetaStore,
+// otherwise the whole response is read. Size is set in both cases.
+func GetResponseMeta(ctx context.Context, store Store, key string, cache *ResponseCache) error {
+	if metaStore, ok := store.(ResponseMetaStore); ok {
+		if err := metaStore.GetResponseMeta(ctx, key, cache); err != ErrNotSupport {
+			return err
+		}
+	}
+
+	if err := NewContextStore(store).GetContext(ctx, key, cache); err != nil {
+		return err
+	}
+	cache.Size = len(cache.Data)
+	return nil
+}
+
+// conditional returns true if request is a GET or HEAD request with If-None-Match or If-Modified-Since
+func conditional(request *http.Request) bool {
+	if request.Method != http.MethodGet && request.Method != http.MethodHead {
+		return false
+	}
+	return request.Header.Get("If-None-Match") != "" || request.Header.Get("If-Modified-Since") != ""
+}
+
+// notModified returns true if the client of the conditional request already has the cached response. If-None-Match
+// is checked against ETag, If-Modified-Since against Last-Modified if there is no If-None-Match (RFC 7232).
+func notModified(request *http.Request, cache *ResponseCache) bool {
+	if !conditional(request) || cache.Status != http.StatusOK {
+		return false
+	}
+
+	if match := request.Header.Get("If-None-Match"); match != "" {
+		etag := strings.TrimPrefix(cache.Header.Get("ETag"), "W/")
+		if etag == "" {
+			return false
+		}
+		for _, candidate := range strings.Split(match, ",") {
+			// Weak comparison
+			candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+			if candidate == "*" || candidate == etag {
+				return true
+			}
+		}
+		return false
+	}
+
+	since, err := http.ParseTime(request.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	modified, err := http.ParseTime(cache.Header.Get("Last-Modified"))
+	if err != nil {
+		// Format of cachedWriter
+		if modified, err = time.Parse(time.RFC1123, cache.Header.Get("Last-Modified")); err != nil {
+			return false
+		}
+	}
+	return !modified.After(since)
+}
@@ -0,0 +1,74 @@
+package cache
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func testConditionalResponses(t *testing.T, store Store) {
+	calls := 0
+	handle := CacheHandlerWithConfig(CacheMiddlewareConfig{Store: store}, func(c echo.Context) error {
+		calls++
+		c.Response().Header().Set("ETag", `"v1"`)
+		return c.String(http.StatusOK, "body")
+	})
+
+	res := serveRequest(handle, echo.GET, "/api/v1/info", nil)
+	assert.Equal(t, "body", res.Body.String())
+	modified := res.Header().Get("Last-Modified")
+
+	res = serveRequest(handle, echo.HEAD, "/api/v1/info", nil)
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, `"v1"`, res.Header().Get("ETag"))
+	assert.Equal(t, "", res.Body.String())
+
+	res = serveRequest(handle, echo.GET, "/api/v1/info", http.Header{"If-None-Match": {`"v0", W/"v1"`}})
+	assert.Equal(t, http.StatusNotModified, res.Code)
+	assert.Equal(t, "", res.Body.String())
+
+	res = serveRequest(handle, echo.GET, "/api/v1/info", http.Header{"If-None-Match": {`"v0"`}})
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, "body", res.Body.String())
+
+	since := time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)
+	res = serveRequest(handle, echo.HEAD, "/api/v1/info", http.Header{"If-Modified-Since": {since}})
+	assert.Equal(t, http.StatusNotModified, res.Code)
+
+	parsed, err := time.Parse(time.RFC1123, modified)
+	if assert.NoError(t, err) {
+		since = parsed.Add(-time.Hour).UTC().Format(http.TimeFormat)
+		res = serveRequest(handle, echo.GET, "/api/v1/info", http.Header{"If-Modified-Since": {since}})
+		assert.Equal(t, http.StatusOK, res.Code)
+		assert.Equal(t, "body", res.Body.String())
+	}
+
+	assert.Equal(t, 1, calls)
+}
+
+func TestConditionalResponses(t *testing.T) {
+	testConditionalResponses(t, NewGoCacheStore(time.Minute, time.Minute))
+}
+
+func TestConditionalResponses_RedisHash(t *testing.T) {
+	redisCache := NewRedisCacheWithOptions(RedisOptions{Host: redisTestServer, Prefix: "test:", HashResponses: true})
+	defer redisCache.Close()
+	assert.NoError(t, redisCache.Flush())
+
+	testConditionalResponses(t, redisCache)
+}
+
+func TestGetResponseMeta(t *testing.T) {
+	store := NewGoCacheStore(time.Minute, time.Minute)
+	var cache ResponseCache
+	assert.Equal(t, ErrCacheMiss, GetResponseMeta(context.Background(), store, "response", &cache))
+
+	assert.NoError(t, store.Set("response", ResponseCache{Status: http.StatusOK, Data: []byte("body")}, DEFAULT))
+	assert.NoError(t, GetResponseMeta(context.Background(), store, "response", &cache))
+	assert.Equal(t, http.StatusOK, cache.Status)
+	assert.Equal(t, 4, cache.Size)
+}
@@ -0,0 +1,111 @@
+package cache
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+//HashRing ketama consistent hash ring. Every node gets vnodes points by unit of weight, adding or removing a node
+// only remaps the keys of its points. Safe for concurrent use.
+type HashRing struct {
+	mu      sync.RWMutex
+	vnodes  int
+	weights map[string]int
+	points  []ringPoint
+}
+
+// ringPoint position of a node on the ring
+type ringPoint struct {
+	hash uint32
+	node string
+}
+
+//NewHashRing create an empty HashRing with vnodes points by unit of weight, 160 like ketama if vnodes <= 0
+func NewHashRing(vnodes int) *HashRing {
+	// Defaults
+	if vnodes <= 0 {
+		vnodes = 160
+	}
+	return &HashRing{vnodes: vnodes, weights: map[string]int{}}
+}
+
+//Add adds node to the ring or updates its weight, a weight <= 0 counts as 1
+func (r *HashRing) Add(node string, weight int) {
+	if weight <= 0 {
+		weight = 1
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.weights[node] = weight
+	r.build()
+}
+
+//Remove removes node from the ring
+func (r *HashRing) Remove(node string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.weights, node)
+	r.build()
+}
+
+//Nodes returns the nodes of the ring sorted by name
+func (r *HashRing) Nodes() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	nodes := make([]string, 0, len(r.weights))
+	for node := range r.weights {
+		nodes = append(nodes, node)
+	}
+	sort.Strings(nodes)
+	return nodes
+}
+
+//Get returns the node of key, false if the ring is empty
+func (r *HashRing) Get(key string) (string, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if len(r.points) == 0 {
+		return "", false
+	}
+
+	hash := ringHash(md5.Sum([]byte(key)), 0)
+	i := sort.Search(len(r.points), func(i int) bool {
+		return r.points[i].hash >= hash
+	})
+	if i == len(r.points) {
+		i = 0
+	}
+	return r.points[i].node, true
+}
+
+// build computes the points of the nodes, every md5 of "node-i" gives 4 points
+func (r *HashRing) build() {
+	r.points = r.points[:0]
+	for node, weight := range r.weights {
+		for i := 0; i < (r.vnodes*weight+3)/4; i++ {
+			digest := md5.Sum([]byte(node + "-" + strconv.Itoa(i)))
+			for part := 0; part < 4; part++ {
+				r.points = append(r.points, ringPoint{ringHash(digest, part), node})
+			}
+		}
+	}
+
+	sort.Slice(r.points, func(i, j int) bool {
+		if r.points[i].hash == r.points[j].hash {
+			// Same result whatever the order of the map
+			return r.points[i].node < r.points[j].node
+		}
+		return r.points[i].hash < r.points[j].hash
+	})
+}
+
+// ringHash returns the part-th little endian uint32 of digest like ketama
+func ringHash(digest [md5.Size]byte, part int) uint32 {
+	return binary.LittleEndian.Uint32(digest[part*4:])
+}
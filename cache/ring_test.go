@@ -0,0 +1,74 @@
+package cache
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func ringKeys(ring *HashRing, n int) map[string]string {
+	nodes := map[string]string{}
+	for i := 0; i < n; i++ {
+		key := "key" + strconv.Itoa(i)
+		nodes[key], _ = ring.Get(key)
+	}
+	return nodes
+}
+
+func TestHashRing(t *testing.T) {
+	ring := NewHashRing(0)
+	_, found := ring.Get("key")
+	assert.False(t, found)
+
+	ring.Add("a", 1)
+	ring.Add("b", 1)
+	ring.Add("c", 1)
+	assert.Equal(t, []string{"a", "b", "c"}, ring.Nodes())
+
+	// Evenly spread
+	before := ringKeys(ring, 10000)
+	counts := map[string]int{}
+	for _, node := range before {
+		counts[node]++
+	}
+	for node, count := range counts {
+		assert.InDelta(t, 3333, count, 600, "node %s", node)
+	}
+
+	// Same ring whatever the insertion order
+	other := NewHashRing(0)
+	other.Add("c", 1)
+	other.Add("a", 1)
+	other.Add("b", 1)
+	assert.Equal(t, before, ringKeys(other, 10000))
+
+	// Only the keys of the new node move
+	ring.Add("d", 1)
+	after := ringKeys(ring, 10000)
+	moved := 0
+	for key, node := range after {
+		if node != before[key] {
+			assert.Equal(t, "d", node)
+			moved++
+		}
+	}
+	assert.InDelta(t, 2500, moved, 600)
+
+	// Only the keys of the removed node move
+	ring.Remove("d")
+	assert.Equal(t, before, ringKeys(ring, 10000))
+}
+
+func TestHashRing_Weight(t *testing.T) {
+	ring := NewHashRing(0)
+	ring.Add("a", 1)
+	ring.Add("b", 3)
+
+	counts := map[string]int{}
+	for _, node := range ringKeys(ring, 10000) {
+		counts[node]++
+	}
+	assert.InDelta(t, 2500, counts["a"], 600)
+	assert.InDelta(t, 7500, counts["b"], 600)
+}
@@ -0,0 +1,264 @@
+package cache
+
+import (
+	"sync"
+	"time"
+)
+
+//ShardedStore Spreads keys over several Stores (shards) with a HashRing, use it to shard keys over several redis
+// hosts. Adding or removing a shard only remaps the keys of its part of the ring, remapped keys are misses until
+// they are stored again in their new shard.
+type ShardedStore struct {
+	ring *HashRing
+
+	// mu guards shards
+	mu     sync.RWMutex
+	shards map[string]Store
+}
+
+//NewShardedStore create a ShardedStore over shards with a weight of 1, shards are identified by their name
+func NewShardedStore(shards map[string]Store) *ShardedStore {
+	c := &ShardedStore{ring: NewHashRing(0), shards: map[string]Store{}}
+	for name, store := range shards {
+		c.AddShard(name, store, 1)
+	}
+	return c
+}
+
+//AddShard adds or replaces the shard name, weight is its share of the keys relative to the other shards
+func (c *ShardedStore) AddShard(name string, store Store, weight int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.shards[name] = store
+	c.ring.Add(name, weight)
+}
+
+//RemoveShard removes the shard name, its keys are spread over the other shards
+func (c *ShardedStore) RemoveShard(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ring.Remove(name)
+	delete(c.shards, name)
+}
+
+//Shard returns the Store holding key
+func (c *ShardedStore) Shard(key string) (Store, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	name, found := c.ring.Get(key)
+	if !found {
+		return nil, ErrNoShard
+	}
+	return c.shards[name], nil
+}
+
+func (c *ShardedStore) Get(key string, value interface{}) error {
+	store, err := c.Shard(key)
+	if err != nil {
+		return err
+	}
+	return store.Get(key, value)
+}
+
+func (c *ShardedStore) Set(key string, value interface{}, expire time.Duration) error {
+	store, err := c.Shard(key)
+	if err != nil {
+		return err
+	}
+	return store.Set(key, value, expire)
+}
+
+func (c *ShardedStore) Add(key string, value interface{}, expire time.Duration) error {
+	store, err := c.Shard(key)
+	if err != nil {
+		return err
+	}
+	return store.Add(key, value, expire)
+}
+
+func (c *ShardedStore) Replace(key string, value interface{}, expire time.Duration) error {
+	store, err := c.Shard(key)
+	if err != nil {
+		return err
+	}
+	return store.Replace(key, value, expire)
+}
+
+func (c *ShardedStore) Delete(key string) error {
+	store, err := c.Shard(key)
+	if err != nil {
+		return err
+	}
+	return store.Delete(key)
+}
+
+func (c *ShardedStore) Increment(key string, delta uint64) (uint64, error) {
+	store, err := c.Shard(key)
+	if err != nil {
+		return 0, err
+	}
+	return store.Increment(key, delta)
+}
+
+func (c *ShardedStore) Decrement(key string, delta uint64) (uint64, error) {
+	store, err := c.Shard(key)
+	if err != nil {
+		return 0, err
+	}
+	return store.Decrement(key, delta)
+}
+
+//Flush flushes every shard and returns the first error
+func (c *ShardedStore) Flush() error {
+	return c.each(func(store Store) error {
+		return store.Flush()
+	})
+}
+
+//Scan calls fn for the keys of every shard, shards must implement ScanStore
+func (c *ShardedStore) Scan(prefix string, fn func(key string) bool) error {
+	c.mu.RLock()
+	stores := make([]Store, 0, len(c.shards))
+	for _, store := range c.shards {
+		stores = append(stores, store)
+	}
+	c.mu.RUnlock()
+
+	next := true
+	for _, store := range stores {
+		err := Scan(store, prefix, func(key string) bool {
+			next = fn(key)
+			return next
+		})
+		if err != nil || !next {
+			return err
+		}
+	}
+	return nil
+}
+
+//GetMulti gets the keys of every shard concurrently
+func (c *ShardedStore) GetMulti(values map[string]interface{}) error {
+	batches, err := c.split(keysOf(values))
+	if err != nil {
+		return err
+	}
+
+	found := make([]map[string]interface{}, len(batches))
+	for i, batch := range batches {
+		found[i] = make(map[string]interface{}, len(batch.keys))
+		for _, key := range batch.keys {
+			found[i][key] = values[key]
+		}
+	}
+	err = parallelShards(batches, func(i int, batch shardBatch) error {
+		return GetMulti(batch.store, found[i])
+	})
+
+	for i, batch := range batches {
+		for _, key := range batch.keys {
+			if _, ok := found[i][key]; !ok {
+				delete(values, key)
+			}
+		}
+	}
+	return err
+}
+
+//SetMulti stores the keys of every shard concurrently
+func (c *ShardedStore) SetMulti(values map[string]interface{}, expire time.Duration) error {
+	batches, err := c.split(keysOf(values))
+	if err != nil {
+		return err
+	}
+
+	return parallelShards(batches, func(_ int, batch shardBatch) error {
+		shardValues := make(map[string]interface{}, len(batch.keys))
+		for _, key := range batch.keys {
+			shardValues[key] = values[key]
+		}
+		return SetMulti(batch.store, shardValues, expire)
+	})
+}
+
+//DeleteMulti deletes the keys of every shard concurrently
+func (c *ShardedStore) DeleteMulti(keys ...string) error {
+	batches, err := c.split(keys)
+	if err != nil {
+		return err
+	}
+
+	return parallelShards(batches, func(_ int, batch shardBatch) error {
+		return DeleteMulti(batch.store, batch.keys...)
+	})
+}
+
+// shardBatch keys of a shard
+type shardBatch struct {
+	store Store
+	keys  []string
+}
+
+// split groups keys by shard
+func (c *ShardedStore) split(keys []string) ([]shardBatch, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var batches []shardBatch
+	indexes := map[string]int{}
+	for _, key := range keys {
+		name, found := c.ring.Get(key)
+		if !found {
+			return nil, ErrNoShard
+		}
+		i, found := indexes[name]
+		if !found {
+			i = len(batches)
+			indexes[name] = i
+			batches = append(batches, shardBatch{store: c.shards[name]})
+		}
+		batches[i].keys = append(batches[i].keys, key)
+	}
+	return batches, nil
+}
+
+// each calls fn for every shard concurrently and returns the first error
+func (c *ShardedStore) each(fn func(store Store) error) error {
+	c.mu.RLock()
+	batches := make([]shardBatch, 0, len(c.shards))
+	for _, store := range c.shards {
+		batches = append(batches, shardBatch{store: store})
+	}
+	c.mu.RUnlock()
+
+	return parallelShards(batches, func(_ int, batch shardBatch) error {
+		return fn(batch.store)
+	})
+}
+
+// parallelShards calls fn for every batch concurrently and returns the first error
+func parallelShards(batches []shardBatch, fn func(i int, batch shardBatch) error) error {
+	var wg sync.WaitGroup
+	errs := make(chan error, len(batches))
+	for i, batch := range batches {
+		wg.Add(1)
+		go func(i int, batch shardBatch) {
+			defer wg.Done()
+			if err := fn(i, batch); err != nil {
+				errs <- err
+			}
+		}(i, batch)
+	}
+	wg.Wait()
+	close(errs)
+	return <-errs
+}
+
+func keysOf(values map[string]interface{}) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	return keys
+}
@@ -0,0 +1,100 @@
+package cache
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var newShardedStore = func(_ *testing.T, defaultExpiration time.Duration) Store {
+	return NewShardedStore(map[string]Store{
+		"a": NewGoCacheStore(defaultExpiration, time.Second),
+		"b": NewGoCacheStore(defaultExpiration, time.Second),
+		"c": NewGoCacheStore(defaultExpiration, time.Second),
+	})
+}
+
+var newShardedRedisStore = func(t *testing.T, defaultExpiration time.Duration) Store {
+	shards := map[string]Store{}
+	for _, name := range []string{"a", "b", "c"} {
+		shards[name] = NewRedisCacheWithOptions(RedisOptions{
+			Host:              redisTestServer,
+			DefaultExpiration: defaultExpiration,
+			Prefix:            "test:" + name + ":",
+		})
+	}
+	store := NewShardedStore(shards)
+	assert.NoError(t, store.Flush())
+	return store
+}
+
+func TestShardedCache_TypicalGetSet(t *testing.T) {
+	typicalGetSet(t, newShardedStore)
+}
+
+func TestShardedCache_IncrDecr(t *testing.T) {
+	incrDecr(t, newShardedStore)
+}
+
+func TestShardedCache_Expiration(t *testing.T) {
+	expiration(t, newShardedStore)
+}
+
+func TestShardedCache_EmptyCache(t *testing.T) {
+	emptyCache(t, newShardedStore)
+}
+
+func TestShardedCache_Replace(t *testing.T) {
+	testReplace(t, newShardedStore)
+}
+
+func TestShardedCache_Add(t *testing.T) {
+	testAdd(t, newShardedStore)
+}
+
+func TestShardedCache_Batch(t *testing.T) {
+	testBatch(t, newShardedStore)
+}
+
+func TestShardedCache_Scan(t *testing.T) {
+	testScan(t, newShardedStore)
+}
+
+func TestShardedCache_RedisBatch(t *testing.T) {
+	testBatch(t, newShardedRedisStore)
+}
+
+func TestShardedCache_RedisScan(t *testing.T) {
+	testScan(t, newShardedRedisStore)
+}
+
+func TestShardedStore_Shards(t *testing.T) {
+	a, b := NewGoCacheStore(time.Hour, time.Minute), NewGoCacheStore(time.Hour, time.Minute)
+	cache := NewShardedStore(nil)
+
+	var get int
+	assert.Equal(t, ErrNoShard, cache.Set("int", 1, DEFAULT))
+	assert.Equal(t, ErrNoShard, cache.GetMulti(map[string]interface{}{"int": &get}))
+
+	cache.AddShard("a", a, 1)
+	cache.AddShard("b", b, 1)
+
+	// Every key is stored in its shard only
+	for i := 0; i < 100; i++ {
+		assert.NoError(t, cache.Set("key"+strconv.Itoa(i), i, DEFAULT))
+	}
+	assert.Equal(t, 100, a.ItemCount()+b.ItemCount())
+	assert.True(t, a.ItemCount() > 20 && b.ItemCount() > 20)
+
+	// Keys of removed shard are misses
+	cache.RemoveShard("b")
+	hits := 0
+	for i := 0; i < 100; i++ {
+		if cache.Get("key"+strconv.Itoa(i), &get) == nil {
+			hits++
+		}
+	}
+	assert.Equal(t, a.ItemCount(), hits)
+}
@@ -0,0 +1,123 @@
+package cache
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// discardWriter http.ResponseWriter of background revalidations, the response is only stored
+type discardWriter struct {
+	header http.Header
+}
+
+func (w *discardWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *discardWriter) WriteHeader(int) {}
+
+func (w *discardWriter) Write(data []byte) (int, error) {
+	return len(data), nil
+}
+
+// SoftPurge marks the response cached under key as stale instead of deleting it. The next request revalidates it
+// while the others keep getting the stale response (see CacheMiddlewareConfig.BackgroundRevalidate).
+// The response keeps its remaining ttl, or gets the default ttl of the store if it was stored with DEFAULT.
+// A LeaseStore marks it stale itself.
+func SoftPurge(store Store, key string) error {
+	if leaseStore, ok := store.(LeaseStore); ok {
+		return leaseStore.Invalidate(key)
+	}
+
+	var cache ResponseCache
+	if err := store.Get(key, &cache); err != nil {
+		return err
+	}
+	if cache.Stale {
+		return nil
+	}
+
+	expire := cache.Expire
+	if expire > 0 {
+		if expire = time.Until(cache.Created.Add(cache.Expire)); expire <= 0 {
+			return ErrCacheMiss
+		}
+	}
+
+	cache.Stale = true
+	return store.Replace(key, cache, expire)
+}
+
+// SoftPurgeTag marks every response cached with tag as stale, returns the number of marked responses
+func SoftPurgeTag(store Store, prefix string, tag string) (int, error) {
+	keys, err := TaggedKeys(store, prefix, tag)
+	if err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	for _, key := range keys {
+		if err := SoftPurge(store, key); err == nil {
+			purged++
+		} else if err != ErrCacheMiss && err != ErrNotStored {
+			return purged, err
+		}
+	}
+	return purged, nil
+}
+
+// revalidateSuffix suffix of the key of the lock taken by the request revalidating a stale response
+const revalidateSuffix = ":revalidate"
+
+// serveStale serves a response marked stale by SoftPurge. Only one request at a time revalidates it, others get
+// the stale response until the new one is stored.
+func (r *responseCacher) serveStale(c echo.Context, next echo.HandlerFunc, key string, cache *ResponseCache) error {
+	lockKey := key + revalidateSuffix
+	if err := r.config.Store.Add(lockKey, true, r.config.RevalidateTimeout); err != nil {
+		// Already revalidating
+		r.config.Stats.stale()
+		return r.serveCache(c, cache)
+	}
+
+	return r.revalidate(c, next, key, cache, func() { _ = r.config.Store.Delete(lockKey) })
+}
+
+// revalidate stores a new response of next under key, in background while cache is served with
+// BackgroundRevalidate. unlock is called once it is done.
+func (r *responseCacher) revalidate(c echo.Context, next echo.HandlerFunc, key string, cache *ResponseCache, unlock func()) error {
+	if !r.config.BackgroundRevalidate {
+		defer unlock()
+
+		r.config.Stats.miss()
+		return r.serveHandler(c, next, key)
+	}
+
+	// Replay the request on a detached context, the response is only stored. c goes back to the pool of echo once
+	// the request is served, the goroutine only uses bc.
+	req := c.Request().WithContext(context.Background())
+	bc := c.Echo().NewContext(req, &discardWriter{header: make(http.Header)})
+	bc.SetPath(c.Path())
+	// Copies, the slices of c are reused with c
+	bc.SetParamNames(append([]string(nil), c.ParamNames()...)...)
+	bc.SetParamValues(append([]string(nil), c.ParamValues()...)...)
+
+	go func() {
+		defer func() {
+			// Nothing recovers panics out of the request goroutine
+			if err := recover(); err != nil {
+				bc.Logger().Errorf("cache: revalidation of %s panicked: %v", key, err)
+			}
+			unlock()
+		}()
+
+		if err := r.serveHandler(bc, next, key); err != nil {
+			bc.Logger().Errorf("cache: revalidation of %s failed: %v", key, err)
+		}
+	}()
+
+	r.config.Stats.stale()
+	return r.serveCache(c, cache)
+}
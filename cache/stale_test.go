@@ -0,0 +1,131 @@
+package cache
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func newStaleHandler(store Store, background bool, body *string, mu *sync.Mutex) echo.HandlerFunc {
+	config := CacheMiddlewareConfig{
+		Store:                store,
+		BackgroundRevalidate: background,
+		Stats:                &Stats{},
+	}
+
+	return CacheHandlerWithConfig(config, func(c echo.Context) error {
+		mu.Lock()
+		defer mu.Unlock()
+		c.Response().Header().Set(HeaderCacheTag, "info")
+		return c.String(http.StatusOK, *body)
+	})
+}
+
+func TestSoftPurge_Revalidate(t *testing.T) {
+	var mu sync.Mutex
+	store := NewGoCacheStore(time.Minute, time.Minute)
+	body := "v1"
+	handle := newStaleHandler(store, false, &body, &mu)
+	key := DefaultCachePrefix + ":" + "%2Fapi%2Fv1%2Finfo"
+
+	assert.Equal(t, ErrCacheMiss, SoftPurge(store, key))
+	assert.Equal(t, "v1", serveRequest(handle, echo.GET, "/api/v1/info", nil).Body.String())
+
+	body = "v2"
+	assert.Equal(t, "v1", serveRequest(handle, echo.GET, "/api/v1/info", nil).Body.String())
+	assert.NoError(t, SoftPurge(store, key))
+
+	// Another request is already revalidating
+	assert.NoError(t, store.Add(key+":revalidate", true, time.Minute))
+	assert.Equal(t, "v1", serveRequest(handle, echo.GET, "/api/v1/info", nil).Body.String())
+	assert.NoError(t, store.Delete(key+":revalidate"))
+
+	assert.Equal(t, "v2", serveRequest(handle, echo.GET, "/api/v1/info", nil).Body.String())
+	assert.Equal(t, "v2", serveRequest(handle, echo.GET, "/api/v1/info", nil).Body.String())
+
+	var cache ResponseCache
+	assert.NoError(t, store.Get(key, &cache))
+	assert.False(t, cache.Stale)
+}
+
+func TestSoftPurgeTag_BackgroundRevalidate(t *testing.T) {
+	var mu sync.Mutex
+	store := NewGoCacheStore(time.Minute, time.Minute)
+	body := "v1"
+	handle := newStaleHandler(store, true, &body, &mu)
+
+	assert.Equal(t, "v1", serveRequest(handle, echo.GET, "/api/v1/info", nil).Body.String())
+
+	mu.Lock()
+	body = "v2"
+	mu.Unlock()
+
+	purged, err := SoftPurgeTag(store, DefaultCachePrefix, "info")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, purged)
+
+	// Stale response is served while revalidating in background
+	assert.Equal(t, "v1", serveRequest(handle, echo.GET, "/api/v1/info", nil).Body.String())
+
+	var cache ResponseCache
+	for i := 0; i < 100; i++ {
+		if err := store.Get(DefaultCachePrefix+":"+"%2Fapi%2Fv1%2Finfo", &cache); err == nil && !cache.Stale {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, "v2", serveRequest(handle, echo.GET, "/api/v1/info", nil).Body.String())
+}
+
+func TestSoftPurge_BackgroundRevalidateParams(t *testing.T) {
+	store := NewGoCacheStore(time.Minute, time.Minute)
+	var mu sync.Mutex
+	version, block := "v1", false
+	started, release := make(chan struct{}), make(chan struct{})
+
+	e := echo.New()
+	e.Use(CacheMiddlewareWithConfig(CacheMiddlewareConfig{Store: store, BackgroundRevalidate: true}))
+	e.GET("/items/:id", func(c echo.Context) error {
+		mu.Lock()
+		wait, v := block, version
+		block = false
+		mu.Unlock()
+		if wait {
+			// The context of the request goes back to the pool of echo meanwhile
+			close(started)
+			<-release
+		}
+		return c.String(http.StatusOK, "item "+c.Param("id")+" "+v)
+	})
+	get := func(uri string) string {
+		res := httptest.NewRecorder()
+		e.ServeHTTP(res, httptest.NewRequest(echo.GET, uri, nil))
+		return res.Body.String()
+	}
+
+	assert.Equal(t, "item 1 v1", get("/items/1"))
+	key := DefaultCachePrefix + ":" + "%2Fitems%2F1"
+	assert.NoError(t, SoftPurge(store, key))
+
+	mu.Lock()
+	version, block = "v2", true
+	mu.Unlock()
+	assert.Equal(t, "item 1 v1", get("/items/1"))
+	<-started
+	assert.Equal(t, "item 2 v2", get("/items/2"))
+	close(release)
+
+	var cache ResponseCache
+	for i := 0; i < 100; i++ {
+		if err := store.Get(key, &cache); err == nil && !cache.Stale {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, "item 1 v2", string(cache.Data))
+}
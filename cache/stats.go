@@ -0,0 +1,65 @@
+package cache
+
+import (
+	"sync/atomic"
+)
+
+//Stats hit / miss / stale counters of a CacheMiddleware, safe for concurrent use. A nil *Stats counts nothing.
+type Stats struct {
+	// Keep 64-bit fields first for atomic operations on 32-bit platforms
+	hits   uint64
+	misses uint64
+	stales uint64
+}
+
+//StatsSnapshot values of Stats at a given time
+type StatsSnapshot struct {
+	Hits    uint64  `json:"hits"`
+	Misses  uint64  `json:"misses"`
+	Stales  uint64  `json:"stales"`
+	HitRate float64 `json:"hit_rate"`
+}
+
+func (s *Stats) hit() {
+	if s != nil {
+		atomic.AddUint64(&s.hits, 1)
+	}
+}
+
+func (s *Stats) miss() {
+	if s != nil {
+		atomic.AddUint64(&s.misses, 1)
+	}
+}
+
+func (s *Stats) stale() {
+	if s != nil {
+		atomic.AddUint64(&s.stales, 1)
+	}
+}
+
+//Snapshot returns current counters
+func (s *Stats) Snapshot() StatsSnapshot {
+	var snapshot StatsSnapshot
+	if s == nil {
+		return snapshot
+	}
+
+	snapshot.Hits = atomic.LoadUint64(&s.hits)
+	snapshot.Misses = atomic.LoadUint64(&s.misses)
+	snapshot.Stales = atomic.LoadUint64(&s.stales)
+	if total := snapshot.Hits + snapshot.Misses + snapshot.Stales; total > 0 {
+		// Stale responses are served from cache too
+		snapshot.HitRate = float64(snapshot.Hits+snapshot.Stales) / float64(total)
+	}
+	return snapshot
+}
+
+//Reset sets counters back to 0
+func (s *Stats) Reset() {
+	if s != nil {
+		atomic.StoreUint64(&s.hits, 0)
+		atomic.StoreUint64(&s.misses, 0)
+		atomic.StoreUint64(&s.stales, 0)
+	}
+}
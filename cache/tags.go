@@ -0,0 +1,91 @@
+package cache
+
+import (
+	"bytes"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// parseTags split HeaderCacheTag value
+func parseTags(header string) []string {
+	var tags []string
+	for _, tag := range strings.Split(header, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// GetTagKey build the key of the index listing cached responses of a tag
+func GetTagKey(prefix string, tag string) string {
+	var buffer bytes.Buffer
+	buffer.WriteString(prefix)
+	buffer.WriteString(":tag:")
+	buffer.WriteString(url.QueryEscape(tag))
+	return buffer.String()
+}
+
+// addTaggedKey add key to the index of every tag. Index are updated with Get / Set, concurrent writes of the same
+// tag can lose keys, a lost key is only left in cache until it expires.
+func addTaggedKey(store Store, prefix string, tags []string, key string, expire time.Duration) error {
+	for _, tag := range tags {
+		tagKey := GetTagKey(prefix, tag)
+
+		var keys []string
+		if err := store.Get(tagKey, &keys); err != nil && err != ErrCacheMiss {
+			return err
+		}
+		if containsKey(keys, key) {
+			continue
+		}
+
+		// Full slice expression, never append to a slice shared with an in-memory store
+		keys = append(keys[:len(keys):len(keys)], key)
+		if err := store.Set(tagKey, keys, expire); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// TaggedKeys returns the keys of the responses cached with tag
+func TaggedKeys(store Store, prefix string, tag string) ([]string, error) {
+	var keys []string
+	if err := store.Get(GetTagKey(prefix, tag), &keys); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// PurgeTag remove every response cached with tag, returns the number of removed responses
+func PurgeTag(store Store, prefix string, tag string) (int, error) {
+	keys, err := TaggedKeys(store, prefix, tag)
+	if err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	for _, key := range keys {
+		if err := store.Delete(key); err == nil {
+			purged++
+		} else if err != ErrCacheMiss {
+			return purged, err
+		}
+	}
+
+	if err := store.Delete(GetTagKey(prefix, tag)); err != nil && err != ErrCacheMiss {
+		return purged, err
+	}
+	return purged, nil
+}
+
+func containsKey(keys []string, key string) bool {
+	for _, k := range keys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,160 @@
+package cache
+
+import (
+	"reflect"
+	"sync/atomic"
+	"time"
+)
+
+//TieredStore Layers an in-memory GoCacheStore (L1) with a short ttl over any Store (L2). Reads fill L1 from L2,
+// writes and deletes go to both. A value changed in L2 by another process is served from L1 until it expires
+// there, keep l1Expire short to bound it. L1 keeps values serialized like a remote store so that they can be read
+// into any type L2 accepts and callers never share them, values that can't be serialized are only kept in L2. A hit
+// in L1 saves the round trip to L2 but still deserializes the value, see BenchmarkTieredStore_Get.
+type TieredStore struct {
+	// Keep 64-bit fields first for atomic operations on 32-bit platforms
+	l1Hits uint64
+	l2Hits uint64
+	misses uint64
+
+	l1       *GoCacheStore
+	l2       Store
+	l1Expire time.Duration
+}
+
+//DefaultTieredL1Expire ttl in L1 of a TieredStore created with a l1Expire which isn't positive
+const DefaultTieredL1Expire = time.Minute
+
+//TieredStats hits by tier of a TieredStore
+type TieredStats struct {
+	L1Hits uint64 `json:"l1_hits"`
+	L2Hits uint64 `json:"l2_hits"`
+	Misses uint64 `json:"misses"`
+}
+
+//NewTieredStore create a TieredStore keeping values of l2 in memory for l1Expire at most, DefaultTieredL1Expire if
+// l1Expire isn't positive
+func NewTieredStore(l2 Store, l1Expire time.Duration) *TieredStore {
+	// Defaults
+	if l1Expire <= 0 {
+		// NEVER would keep the values of L2 in memory for good
+		l1Expire = DefaultTieredL1Expire
+	}
+
+	return &TieredStore{
+		l1:       NewGoCacheStore(l1Expire, l1Expire),
+		l2:       l2,
+		l1Expire: l1Expire,
+	}
+}
+
+//Stats returns the hits by tier since the creation of the store
+func (c *TieredStore) Stats() TieredStats {
+	return TieredStats{
+		L1Hits: atomic.LoadUint64(&c.l1Hits),
+		L2Hits: atomic.LoadUint64(&c.l2Hits),
+		Misses: atomic.LoadUint64(&c.misses),
+	}
+}
+
+func (c *TieredStore) Get(key string, value interface{}) error {
+	if err := c.getL1(key, value); err == nil {
+		atomic.AddUint64(&c.l1Hits, 1)
+		return nil
+	}
+
+	if err := c.l2.Get(key, value); err != nil {
+		if err == ErrCacheMiss {
+			atomic.AddUint64(&c.misses, 1)
+		}
+		return err
+	}
+	atomic.AddUint64(&c.l2Hits, 1)
+
+	// Keep the value pointed by value like L2 stored it
+	c.setL1(key, reflect.ValueOf(value).Elem().Interface(), c.l1Expire)
+	return nil
+}
+
+func (c *TieredStore) Set(key string, value interface{}, expire time.Duration) error {
+	if err := c.l2.Set(key, value, expire); err != nil {
+		_ = c.l1.Delete(key)
+		return err
+	}
+	c.setL1(key, value, c.expire(expire))
+	return nil
+}
+
+func (c *TieredStore) Add(key string, value interface{}, expire time.Duration) error {
+	if err := c.l2.Add(key, value, expire); err != nil {
+		return err
+	}
+	c.setL1(key, value, c.expire(expire))
+	return nil
+}
+
+func (c *TieredStore) Replace(key string, value interface{}, expire time.Duration) error {
+	if err := c.l2.Replace(key, value, expire); err != nil {
+		_ = c.l1.Delete(key)
+		return err
+	}
+	c.setL1(key, value, c.expire(expire))
+	return nil
+}
+
+func (c *TieredStore) Delete(key string) error {
+	_ = c.l1.Delete(key)
+	return c.l2.Delete(key)
+}
+
+//Increment the value is only kept in L2, L1 is invalidated
+func (c *TieredStore) Increment(key string, delta uint64) (uint64, error) {
+	_ = c.l1.Delete(key)
+	return c.l2.Increment(key, delta)
+}
+
+//Decrement the value is only kept in L2, L1 is invalidated
+func (c *TieredStore) Decrement(key string, delta uint64) (uint64, error) {
+	_ = c.l1.Delete(key)
+	return c.l2.Decrement(key, delta)
+}
+
+func (c *TieredStore) Flush() error {
+	_ = c.l1.Flush()
+	return c.l2.Flush()
+}
+
+// expire returns the ttl in L1 of a value stored with expire in L2
+func (c *TieredStore) expire(expire time.Duration) time.Duration {
+	if expire > 0 && expire < c.l1Expire {
+		return expire
+	}
+	return c.l1Expire
+}
+
+// getL1 reads the value of key from L1
+func (c *TieredStore) getL1(key string, value interface{}) error {
+	var b []byte
+	if err := c.l1.Get(key, &b); err != nil {
+		return err
+	}
+	if _, ok := value.(*[]byte); ok {
+		// deserialize hands out b itself
+		b = append([]byte(nil), b...)
+	}
+	return deserialize(b, value)
+}
+
+// setL1 stores value in L1 serialized, or drops the value of key from L1 if it can't be serialized
+func (c *TieredStore) setL1(key string, value interface{}, expire time.Duration) {
+	b, err := serialize(value)
+	if err != nil {
+		_ = c.l1.Delete(key)
+		return
+	}
+	if _, ok := value.([]byte); ok {
+		// serialize returns value itself
+		b = append([]byte(nil), b...)
+	}
+	_ = c.l1.Set(key, b, expire)
+}
@@ -0,0 +1,150 @@
+package cache
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var newTieredStore = func(_ *testing.T, defaultExpiration time.Duration) Store {
+	return NewTieredStore(NewGoCacheStore(defaultExpiration, time.Second), 500*time.Millisecond)
+}
+
+func TestTieredCache_TypicalGetSet(t *testing.T) {
+	typicalGetSet(t, newTieredStore)
+}
+
+func TestTieredCache_IncrDecr(t *testing.T) {
+	incrDecr(t, newTieredStore)
+}
+
+func TestTieredCache_Expiration(t *testing.T) {
+	expiration(t, newTieredStore)
+}
+
+func TestTieredCache_EmptyCache(t *testing.T) {
+	emptyCache(t, newTieredStore)
+}
+
+func TestTieredCache_Replace(t *testing.T) {
+	testReplace(t, newTieredStore)
+}
+
+func TestTieredCache_Add(t *testing.T) {
+	testAdd(t, newTieredStore)
+}
+
+func TestTieredStore_Stats(t *testing.T) {
+	l2 := NewGoCacheStore(time.Hour, time.Minute)
+	cache := NewTieredStore(l2, 200*time.Millisecond)
+
+	var get int
+	assert.Equal(t, ErrCacheMiss, cache.Get("int", &get))
+
+	// Filled by the write
+	assert.NoError(t, cache.Set("int", 1, DEFAULT))
+	assert.NoError(t, cache.Get("int", &get))
+	assert.Equal(t, 1, get)
+
+	// Changed in L2 only, L1 serves the old value until it expires
+	assert.NoError(t, l2.Set("int", 2, DEFAULT))
+	assert.NoError(t, cache.Get("int", &get))
+	assert.Equal(t, 1, get)
+	time.Sleep(300 * time.Millisecond)
+	assert.NoError(t, cache.Get("int", &get))
+	assert.Equal(t, 2, get)
+
+	// Filled by the read
+	assert.NoError(t, cache.Get("int", &get))
+	assert.Equal(t, 2, get)
+
+	assert.Equal(t, TieredStats{L1Hits: 3, L2Hits: 1, Misses: 1}, cache.Stats())
+
+	// Deleted from both tiers
+	assert.NoError(t, cache.Delete("int"))
+	assert.Equal(t, ErrCacheMiss, l2.Get("int", &get))
+	assert.Equal(t, ErrCacheMiss, cache.Get("int", &get))
+}
+
+func TestNewTieredStore_L1Expire(t *testing.T) {
+	assert.Equal(t, DefaultTieredL1Expire, NewTieredStore(NewGoCacheStore(time.Hour, time.Minute), DEFAULT).l1Expire)
+	assert.Equal(t, DefaultTieredL1Expire, NewTieredStore(NewGoCacheStore(time.Hour, time.Minute), NEVER).l1Expire)
+	assert.Equal(t, time.Second, NewTieredStore(NewGoCacheStore(time.Hour, time.Minute), time.Second).l1Expire)
+}
+
+func TestTieredCache_RedisTypicalGetSet(t *testing.T) {
+	typicalGetSet(t, func(t *testing.T, defaultExpiration time.Duration) Store {
+		return NewTieredStore(newRedisStore(t, defaultExpiration), 500*time.Millisecond)
+	})
+}
+
+func TestTieredStore_Types(t *testing.T) {
+	type object struct {
+		Name  string
+		Items map[string]int
+	}
+	cache := NewTieredStore(newRedisStore(t, time.Hour), time.Minute)
+
+	// Stored from a pointer, read into a value
+	stored := object{Name: "name", Items: map[string]int{"a": 1}}
+	assert.NoError(t, cache.Set("object", &stored, DEFAULT))
+	var get object
+	assert.NoError(t, cache.Get("object", &get))
+	assert.Equal(t, stored, get)
+
+	// Callers don't share the value kept in L1
+	get.Items["a"] = 2
+	var other object
+	assert.NoError(t, cache.Get("object", &other))
+	assert.Equal(t, 1, other.Items["a"])
+
+	// Stored as an int, read as an int64
+	assert.NoError(t, cache.Set("int", 1, DEFAULT))
+	var i int64
+	assert.NoError(t, cache.Get("int", &i))
+	assert.Equal(t, int64(1), i)
+
+	// Filled by the read of an int, read as an uint64
+	assert.NoError(t, cache.Set("int", 2, DEFAULT))
+	assert.NoError(t, cache.l1.Delete("int"))
+	assert.NoError(t, cache.Get("int", &i))
+	var u uint64
+	assert.NoError(t, cache.Get("int", &u))
+	assert.Equal(t, uint64(2), u)
+	assert.Equal(t, uint64(1), cache.Stats().L2Hits)
+}
+
+// BenchmarkTieredStore_Get compares a hit in L1, which deserializes the value, with a hit in GoCacheStore and a read
+// from redis
+func BenchmarkTieredStore_Get(b *testing.B) {
+	response := ResponseCache{
+		Status: http.StatusOK,
+		Header: http.Header{"Content-Type": {"application/json"}},
+		Data:   make([]byte, 4096),
+		URI:    "/api/v1/info",
+	}
+	stores := []struct {
+		name  string
+		store Store
+	}{
+		{"l1", NewTieredStore(NewGoCacheStore(time.Hour, time.Minute), time.Minute)},
+		{"gocache", NewGoCacheStore(time.Hour, time.Minute)},
+		{"redis", NewRedisCache(redisTestServer, "", time.Hour)},
+	}
+	for _, s := range stores {
+		b.Run(s.name, func(b *testing.B) {
+			if err := s.store.Set("response", response, DEFAULT); err != nil {
+				b.Skip(err)
+			}
+			var cache ResponseCache
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := s.store.Get("response", &cache); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,23 @@
+package cache
+
+import (
+	"time"
+)
+
+// TTL returns the remaining ttl of key, NEVER if key doesn't expire
+// Returns ErrNotSupport if store doesn't implement TTLStore
+func TTL(store Store, key string) (time.Duration, error) {
+	if ttlStore, ok := store.(TTLStore); ok {
+		return ttlStore.TTL(key)
+	}
+	return 0, ErrNotSupport
+}
+
+// Touch sets the ttl of key to expire without rewriting its value
+// Returns ErrNotSupport if store doesn't implement TTLStore
+func Touch(store Store, key string, expire time.Duration) error {
+	if ttlStore, ok := store.(TTLStore); ok {
+		return ttlStore.Touch(key, expire)
+	}
+	return ErrNotSupport
+}
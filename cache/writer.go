@@ -1,6 +1,7 @@
 package cache
 
 import (
+	"context"
 	"net/http"
 	"time"
 
@@ -12,6 +13,19 @@ type (
 		Status int
 		Header http.Header
 		Data   []byte
+
+		// URI request URI of the cached response, used to match BAN requests
+		URI string
+		// Created time when the response was stored
+		Created time.Time
+		// Tags values of the HeaderCacheTag response header, used to purge responses by tag
+		Tags []string
+		// Expire ttl the response was stored with
+		Expire time.Duration
+		// Stale response marked by SoftPurge, served while it is revalidated
+		Stale bool
+		// Size length of Data, also set when Data isn't read (see GetResponseMeta)
+		Size int
 	}
 
 	cachedWriter struct {
@@ -20,15 +34,17 @@ type (
 
 		status  int
 		written bool
+		stored  bool
 
-		store  Store
-		expire time.Duration
+		cacher *responseCacher
+		ctx    context.Context
 		key    string
+		uri    string
 	}
 )
 
-func newCachedWriter(store Store, expire time.Duration, writer http.ResponseWriter, response *echo.Response, key string) *cachedWriter {
-	return &cachedWriter{writer, response, 0, false, store, expire, key}
+func newCachedWriter(cacher *responseCacher, ctx context.Context, writer http.ResponseWriter, response *echo.Response, key string, uri string) *cachedWriter {
+	return &cachedWriter{writer, response, 0, false, false, cacher, ctx, key, uri}
 }
 
 func (w *cachedWriter) Header() http.Header {
@@ -51,11 +67,23 @@ func (w *cachedWriter) Write(data []byte) (int, error) {
 		header.Add("Last-Modified", currentTime.Format(time.RFC1123))
 
 		val := ResponseCache{
-			w.response.Status,
-			header,
-			copy(data),
+			Status:  w.response.Status,
+			Header:  header,
+			Data:    copy(data),
+			Size:    len(data),
+			URI:     w.uri,
+			Created: currentTime,
+			Tags:    parseTags(header.Get(HeaderCacheTag)),
+		}
+
+		config := w.cacher.config
+		val.Expire = config.Expire
+		if err := w.cacher.store.SetContext(w.ctx, w.key, val, config.Expire); err == nil {
+			w.stored = true
+			if len(val.Tags) > 0 {
+				_ = addTaggedKey(config.Store, config.KeyPrefix, val.Tags, w.key, config.Expire)
+			}
 		}
-		_ = w.store.Set(w.key, val, w.expire)
 	}
 	return ret, err
 }